@@ -0,0 +1,118 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+)
+
+// Baseline records the migrations up to version as executed without
+// running them, to adopt the migrations on an existing schema
+func (m *Migrator) Baseline(ctx context.Context, version int64) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.baseline(ctx, version)
+	})
+}
+
+// baseline fails with ErrBaselineNotEmpty when migrations are already
+// recorded, unless ForceBaseline is used, then they are replaced, with
+// the Tag option only the migrations of the tagged files are considered
+func (m *Migrator) baseline(ctx context.Context, target int64) (number int, recorded []string, err error) {
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	idx, err := targetIndex(m.opts.strategy, files, target)
+	if err != nil || idx == 0 {
+		return
+	}
+	count, err := m.recordedCount(ctx, files)
+	if err != nil {
+		return
+	}
+	if count > 0 && !m.opts.forceBaseline {
+		err = fmt.Errorf("%w, %v migrations recorded", ErrBaselineNotEmpty, count)
+		return
+	}
+	if count > 0 {
+		err = m.destructive("baseline")
+		if err != nil {
+			return
+		}
+	}
+	batch := files[:idx]
+	start := 0
+	if m.opts.baselineOnly {
+		start = idx - 1
+	}
+	if m.opts.dryRun != nil {
+		for _, f := range batch[start:] {
+			var v int64
+			v, err = version(m.opts.strategy, f)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(m.opts.dryRun, "-- insert %v version %v\n", m.cfg.TableName, v) // nolint
+		}
+		return idx - start, batch[start:], nil
+	}
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	if m.opts.tag == "" {
+		_, err = tx.ExecContext(ctx, m.cfg.query(`DELETE FROM %[1]s`))
+	} else {
+		err = m.deleteFiles(ctx, tx, files)
+	}
+	if err != nil {
+		m.rollback(tx)
+		return
+	}
+	for _, f := range batch[start:] {
+		var v int64
+		v, err = version(m.opts.strategy, f)
+		if err != nil {
+			m.rollback(tx)
+			return
+		}
+		var sum string
+		sum, err = m.upChecksum(f)
+		if err != nil {
+			m.rollback(tx)
+			return
+		}
+		err = insertMigrations(ctx, v, f, sum, tx, m.cfg)
+		if err != nil {
+			m.rollback(tx)
+			return
+		}
+	}
+	err = m.commit(tx)
+	if err != nil {
+		return
+	}
+	return idx - start, batch[start:], nil
+}
+
+// recordedCount return the number of recorded migrations, with the Tag
+// option only the versions of the tagged files are counted
+func (m *Migrator) recordedCount(ctx context.Context, files []string) (int, error) {
+	if m.opts.tag == "" {
+		return migrationCount(ctx, m.conn(), m.cfg)
+	}
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, f := range files {
+		v, err := version(m.opts.strategy, f)
+		if err != nil {
+			return 0, err
+		}
+		if applied[v] {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunBaseline(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, recorded, err := Run(ctx, "migrations", url, "baseline 2", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql"}; n != 2 || !reflect.DeepEqual(recorded, want) {
+		t.Errorf("expected %v recorded but got %v %v", want, n, recorded)
+	}
+	n, pending, err := Run(ctx, "migrations", url, "status", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/003_c.up.sql"}; n != 1 || !reflect.DeepEqual(pending, want) {
+		t.Errorf("expected only %v pending but got %v %v", want, n, pending)
+	}
+	_, _, err = Run(ctx, "migrations", url, "baseline 3", WithFS(fsys))
+	if !errors.Is(err, ErrBaselineNotEmpty) {
+		t.Fatalf("expected ErrBaselineNotEmpty but got %v", err)
+	}
+	n, _, err = Run(ctx, "migrations", url, "baseline 3", WithFS(fsys), ForceBaseline(), BaselineOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{3}; n != 1 || !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected only the version %v recorded but got %v %v", want, n, versions)
+	}
+	n, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to execute after the baseline but got %v %v", n, err)
+	}
+}
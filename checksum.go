@@ -0,0 +1,112 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// checksum return the sha256 of the migration file contents
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// upChecksum return the checksum of the up file recorded when it is
+// executed, Go migrations have no checksum
+func (m *Migrator) upChecksum(file string) (string, error) {
+	if _, ok := registeredGo(file); ok {
+		return "", nil
+	}
+	b, err := readMigration(m.opts.src, file, "up")
+	if err != nil {
+		return "", err
+	}
+	return checksum(b), nil
+}
+
+// drift return the executed migrations whose file was changed after
+// being executed and the recorded versions without an up file
+func (m *Migrator) drift(ctx context.Context, files []string) (changed []string, missing []int64, err error) {
+	var rows []struct {
+		Version  int64  `db:"version"`
+		Checksum string `db:"checksum"`
+	}
+	if m.cfg.noTable {
+		return
+	}
+	err = sqlx.SelectContext(ctx, m.conn(), &rows, m.cfg.query(`SELECT version, coalesce(checksum, '') AS checksum FROM %[1]s ORDER BY version`))
+	if err != nil {
+		return
+	}
+	byVersion, err := fileVersions(m.opts.strategy, files)
+	if err != nil {
+		return
+	}
+	for _, r := range rows {
+		if r.Version < 1 {
+			continue
+		}
+		f, ok := byVersion[r.Version]
+		if !ok {
+			missing = append(missing, r.Version)
+			continue
+		}
+		if _, ok := registeredGo(f); ok || r.Checksum == "" {
+			continue
+		}
+		var b []byte
+		b, err = readMigration(m.opts.src, f, "up")
+		if err != nil {
+			return
+		}
+		if checksum(b) != r.Checksum {
+			changed = append(changed, f)
+		}
+	}
+	return
+}
+
+// verifyChecksums compare the checksum recorded for each executed
+// migration with the current contents of its file
+func (m *Migrator) verifyChecksums(ctx context.Context, files []string) (err error) {
+	changed, _, err := m.drift(ctx, files)
+	if err != nil {
+		return
+	}
+	for _, f := range changed {
+		if m.opts.strictChecksums {
+			err = fmt.Errorf("%w, %v was changed after being executed", ErrChecksumMismatch, f)
+			return
+		}
+		m.opts.log.Warn(fmt.Sprintf("checksum mismatch, %v was changed after being executed", f), "file", f)
+	}
+	return
+}
+
+// verify return the executed migration files that were changed and the
+// recorded versions whose file is missing, it fails with ErrDrift when
+// there are any, nothing is executed
+func (m *Migrator) verify(ctx context.Context) (n int, drifted []string, err error) {
+	// the files of the other tags are not missing
+	files, err := upFiles(m.opts.strategy, m.opts.src, m.source)
+	if err != nil {
+		return
+	}
+	changed, missing, err := m.drift(ctx, files)
+	if err != nil {
+		return
+	}
+	drifted = changed
+	for _, v := range missing {
+		drifted = append(drifted, fmt.Sprintf("version %v has no migration file", v))
+	}
+	n = len(drifted)
+	if n > 0 {
+		err = fmt.Errorf("%w, %v drifted", ErrDrift, n)
+	}
+	return
+}
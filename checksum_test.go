@@ -0,0 +1,92 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_checksum(t *testing.T) {
+	got := checksum([]byte("CREATE TABLE a (id int);"))
+	if len(got) != 64 {
+		t.Fatalf("expected a sha256 hex string but got %q", got)
+	}
+	if got != checksum([]byte("CREATE TABLE a (id int);")) {
+		t.Error("expected the same checksum for the same contents")
+	}
+	if got == checksum([]byte("CREATE TABLE a (id bigint);")) {
+		t.Error("expected a different checksum for different contents")
+	}
+}
+
+func TestRunChecksumMismatch(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := t.TempDir()
+	files := map[string]string{
+		"001_a.up.sql":   `CREATE TABLE checksum_a (id int);`,
+		"001_a.down.sql": `DROP TABLE checksum_a;`,
+	}
+	for name, sql := range files {
+		err := os.WriteFile(filepath.Join(source, name), []byte(sql), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := Run(context.Background(), source, url, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Run(context.Background(), source, url, "down") // nolint
+	err = os.WriteFile(filepath.Join(source, "001_a.up.sql"), []byte(`CREATE TABLE checksum_b (id int);`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, _, err = Run(context.Background(), source, url, "status", Warnings(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "001_a.up.sql") {
+		t.Errorf("expected a checksum warning, got %q", buf.String())
+	}
+	_, _, err = Run(context.Background(), source, url, "up", StrictChecksums())
+	if err == nil {
+		t.Error("expected checksum mismatch error")
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := Run(ctx, "migrations", url, "verify", WithFS(fsys))
+	if err != nil || n != 0 {
+		t.Fatalf("expected no drift but got %v %v", n, err)
+	}
+	fsys["migrations/001_a.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id bigint);")}
+	delete(fsys, "migrations/002_b.up.sql")
+	delete(fsys, "migrations/002_b.down.sql")
+	n, drifted, err := Run(ctx, "migrations", url, "verify", WithFS(fsys))
+	if !errors.Is(err, ErrDrift) {
+		t.Fatalf("expected ErrDrift but got %v", err)
+	}
+	want := []string{"migrations/001_a.up.sql", "version 2 has no migration file"}
+	if n != 2 || !reflect.DeepEqual(drifted, want) {
+		t.Errorf("expected %v drifted but got %v %v", want, n, drifted)
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// noColor is set by the -no-color flag
+var noColor bool
+
+// isColorSupported reports whether stdout is a terminal that
+// understands colors, NO_COLOR disables colors when not empty
+func isColorSupported() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	term := os.Getenv("TERM")
+	if term == "" || term == "dumb" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize return s in the color when colors are supported
+func colorize(s, color string) string {
+	if !isColorSupported() {
+		return s
+	}
+	return color + s + colorReset
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("NO_COLOR", "1")
+	if got := colorize("SUCCESS", colorGreen); got != "SUCCESS" {
+		t.Errorf("expected plain text with NO_COLOR but got %q", got)
+	}
+	t.Setenv("NO_COLOR", "")
+	noColor = true
+	defer func() { noColor = false }()
+	if got := colorize("FAILED", colorRed); got != "FAILED" {
+		t.Errorf("expected plain text with -no-color but got %q", got)
+	}
+}
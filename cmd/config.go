@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gosidekick/migration/v3"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read when it exists and -config is not set
+const defaultConfigFile = "migration.yaml"
+
+// pgEnvURL is used when there is no database URL and the libpq PG*
+// environment variables are set, the PostgreSQL drivers read them
+const pgEnvURL = "postgres://"
+
+// defaultMigrationsDir is searched from the working directory up to
+// the repository root when no migrations directory is given
+const defaultMigrationsDir = "migrations"
+
+// config holds the exec settings, the command line flags take
+// precedence over the config file and the config file over the
+// environment variables
+type config struct {
+	URL     string        `yaml:"url"`
+	URLFile string        `yaml:"url_file"`
+	Dir     string        `yaml:"dir"`
+	Action  string        `yaml:"action"`
+	Table   string        `yaml:"table"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Script is a file with the actions to perform, one per line
+	Script string `yaml:"script"`
+	// Stdin executes the SQL read from stdin instead of the migrations
+	Stdin bool `yaml:"-"`
+}
+
+// loadConfig read the config file and merge it with the flags
+// and the environment variables
+func loadConfig(c *cli.Context) (cfg config, err error) {
+	path := c.String("config")
+	if path == "" {
+		path = defaultConfigFile
+	}
+	b, err := os.ReadFile(path) // nolint
+	if errors.Is(err, fs.ErrNotExist) && !c.IsSet("config") {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(b, &cfg)
+	if err != nil {
+		err = fmt.Errorf("invalid config file %v: %w", path, err)
+		return
+	}
+	cfg.URL, err = databaseURL(c, cfg)
+	if err != nil {
+		return
+	}
+	cfg.Stdin = c.Bool("sql-stdin")
+	if cfg.Stdin {
+		if c.IsSet("dir") || c.IsSet("action") || c.NArg() > 0 {
+			err = errors.New("-sql-stdin can't be used with -dir or an action")
+			return
+		}
+		cfg.Dir, cfg.Action = "", ""
+	} else {
+		cfg.Dir = value(c, "dir", cfg.Dir, "MIGRATIONS")
+		cfg.Action, err = action(c, cfg.Action)
+		if err != nil {
+			return
+		}
+	}
+	if c.IsSet("script") {
+		cfg.Script = c.String("script")
+	}
+	if cfg.Script != "" {
+		if cfg.Stdin || c.IsSet("action") || c.NArg() > 0 {
+			err = errors.New("-script can't be used with -sql-stdin or an action")
+			return
+		}
+		cfg.Action = ""
+	}
+	if cfg.Dir == "" && !cfg.Stdin {
+		wd, err := os.Getwd()
+		if err != nil {
+			return cfg, err
+		}
+		if dir, ok := discoverDir(wd); ok {
+			cfg.Dir = dir
+			if !c.Bool("quiet") {
+				fmt.Fprintf(os.Stderr, "using migrations directory %v\n", dir)
+			}
+		}
+	}
+	cfg.Table = value(c, "table", cfg.Table, "MIGRATIONS_TABLE")
+	if c.IsSet("timeout") || cfg.Timeout == 0 {
+		cfg.Timeout = c.Duration("timeout")
+	}
+	err = cfg.validate()
+	return
+}
+
+// value return the flag if it was set in the command line, else
+// the config file value, the environment variable or the flag default
+func value(c *cli.Context, name, file, env string) string {
+	if c.IsSet(name) {
+		return c.String(name)
+	}
+	if file != "" {
+		return file
+	}
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return c.String(name)
+}
+
+// action return the positional arguments, e.g. up 1, or the -action
+// flag, keeping the flags, config file and environment variables precedence
+func action(c *cli.Context, file string) (string, error) {
+	if c.NArg() == 0 {
+		return value(c, "action", file, "ACTION"), nil
+	}
+	if c.IsSet("action") {
+		return "", fmt.Errorf("use -action or the positional action %q, not both", strings.Join(c.Args(), " "))
+	}
+	return strings.Join(c.Args(), " "), nil
+}
+
+// databaseURL return the -url flag, else the contents of the -url-file,
+// keeping the flags, config file and environment variables precedence
+func databaseURL(c *cli.Context, cfg config) (string, error) {
+	switch {
+	case c.IsSet("url"):
+		return c.String("url"), nil
+	case c.IsSet("url-file"):
+		return readURLFile(c.String("url-file"))
+	case cfg.URL != "":
+		return cfg.URL, nil
+	case cfg.URLFile != "":
+		return readURLFile(cfg.URLFile)
+	case os.Getenv("DATABASE_URL_FILE") != "":
+		return readURLFile(os.Getenv("DATABASE_URL_FILE"))
+	}
+	if v := os.Getenv("DATABASE_URL"); v != "" {
+		return v, nil
+	}
+	if pgEnv() {
+		return pgEnvURL, nil
+	}
+	return "", nil
+}
+
+// pgEnv report if any of the libpq environment variables is set
+func pgEnv() bool {
+	for _, name := range []string{"PGHOST", "PGPORT", "PGUSER", "PGPASSWORD", "PGDATABASE"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverDir walks up from dir looking for a migrations directory,
+// it stops at the repository root, the directory with .git
+func discoverDir(dir string) (string, bool) {
+	for {
+		candidate := filepath.Join(dir, defaultMigrationsDir)
+		info, err := os.Stat(candidate)
+		if err == nil && info.IsDir() {
+			return candidate, true
+		}
+		_, err = os.Stat(filepath.Join(dir, ".git"))
+		if err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// readURLFile read the database URL from a secret file
+func readURLFile(path string) (string, error) {
+	b, err := os.ReadFile(path) // nolint
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (cfg config) validate() error {
+	switch {
+	case cfg.Action == "" && !cfg.Stdin && cfg.Script == "":
+		return migration.ErrEmptyAction
+	case cfg.URL == "":
+		return errors.New("database url is required, use -url, -url-file, DATABASE_URL, the PG* variables or the config file")
+	case cfg.Dir == "" && !cfg.Stdin:
+		return migration.ErrNoDirectory
+	case cfg.Timeout < 0:
+		return fmt.Errorf("invalid timeout %v", cfg.Timeout)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// parseConfig runs the exec flags parser with args and return the config
+func parseConfig(t *testing.T, args ...string) (cfg config, err error) {
+	t.Helper()
+	app := cli.NewApp()
+	app.Commands = []cli.Command{{
+		Name:  "exec",
+		Flags: execCmd.Flags,
+		Action: func(c *cli.Context) error {
+			cfg, err = loadConfig(c)
+			return nil
+		},
+	}}
+	runErr := app.Run(append([]string{"migration", "exec"}, args...))
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	return
+}
+
+func TestLoadConfigURLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database_url")
+	err := os.WriteFile(path, []byte("postgres://file@localhost/test\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATABASE_URL", "postgres://env@localhost/test")
+	cfg, err := parseConfig(t, "-url-file", path, "-dir", "migrations", "-action", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://file@localhost/test"; cfg.URL != want {
+		t.Errorf("expected url %v but got %v", want, cfg.URL)
+	}
+	cfg, err = parseConfig(t, "-url", "postgres://flag@localhost/test", "-url-file", path, "-dir", "migrations", "-action", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://flag@localhost/test"; cfg.URL != want {
+		t.Errorf("expected url %v but got %v", want, cfg.URL)
+	}
+	t.Setenv("DATABASE_URL_FILE", path)
+	cfg, err = parseConfig(t, "-dir", "migrations", "-action", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://file@localhost/test"; cfg.URL != want {
+		t.Errorf("expected url %v but got %v", want, cfg.URL)
+	}
+	_, err = parseConfig(t, "-url-file", filepath.Join(t.TempDir(), "missing"), "-dir", "migrations", "-action", "up")
+	if err == nil {
+		t.Error("expected an error for a missing url file")
+	}
+}
+
+func TestLoadConfigPositionalAction(t *testing.T) {
+	cfg, err := parseConfig(t, "-url", "postgres://flag@localhost/test", "-dir", "migrations", "up", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "up 1"; cfg.Action != want {
+		t.Errorf("expected action %q but got %q", want, cfg.Action)
+	}
+	t.Setenv("ACTION", "down")
+	cfg, err = parseConfig(t, "-url", "postgres://flag@localhost/test", "-dir", "migrations", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "status"; cfg.Action != want {
+		t.Errorf("expected action %q but got %q", want, cfg.Action)
+	}
+	_, err = parseConfig(t, "-url", "postgres://flag@localhost/test", "-dir", "migrations", "-action", "up", "down")
+	if err == nil {
+		t.Error("expected an error for both -action and a positional action")
+	}
+}
+
+func Test_discoverDir(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	for _, dir := range []string{
+		filepath.Join(root, "migrations"),
+		filepath.Join(repo, ".git"),
+		filepath.Join(repo, "db", "migrations"),
+		filepath.Join(repo, "db", "cmd", "app"),
+		filepath.Join(repo, "web"),
+	} {
+		err := os.MkdirAll(dir, 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		dir  string
+		want string
+		ok   bool
+	}{
+		{name: "parent", dir: filepath.Join(repo, "db", "cmd", "app"), want: filepath.Join(repo, "db", "migrations"), ok: true},
+		{name: "same directory", dir: filepath.Join(repo, "db"), want: filepath.Join(repo, "db", "migrations"), ok: true},
+		{name: "stops at .git", dir: filepath.Join(repo, "web")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := discoverDir(tt.dir)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("discoverDir() = %v %v, want %v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLoadConfigStdin(t *testing.T) {
+	cfg, err := parseConfig(t, "-url", "postgres://flag@localhost/test", "-sql-stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Stdin || cfg.Action != "" || cfg.Dir != "" {
+		t.Errorf("expected only stdin but got %+v", cfg)
+	}
+	for _, args := range [][]string{
+		{"-url", "postgres://flag@localhost/test", "-sql-stdin", "-dir", "migrations"},
+		{"-url", "postgres://flag@localhost/test", "-sql-stdin", "-action", "up"},
+		{"-url", "postgres://flag@localhost/test", "-sql-stdin", "up"},
+	} {
+		_, err = parseConfig(t, args...)
+		if err == nil {
+			t.Errorf("expected -sql-stdin to fail with %v", args)
+		}
+	}
+}
+
+func TestLoadConfigScript(t *testing.T) {
+	cfg, err := parseConfig(t, "-url", "postgres://flag@localhost/test", "-dir", "migrations", "-script", "deploy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Script != "deploy.txt" || cfg.Action != "" {
+		t.Errorf("expected only the script but got %+v", cfg)
+	}
+	for _, args := range [][]string{
+		{"-url", "postgres://flag@localhost/test", "-dir", "migrations", "-script", "deploy.txt", "-action", "up"},
+		{"-url", "postgres://flag@localhost/test", "-dir", "migrations", "-script", "deploy.txt", "up"},
+	} {
+		_, err = parseConfig(t, args...)
+		if err == nil {
+			t.Errorf("expected -script to fail with %v", args)
+		}
+	}
+}
+
+func TestLoadConfigPGEnv(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("PGHOST", "")
+	_, err := parseConfig(t, "-dir", "migrations", "up")
+	if err == nil {
+		t.Error("expected an error without url")
+	}
+	t.Setenv("PGHOST", "db.example.com")
+	cfg, err := parseConfig(t, "-dir", "migrations", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.URL != pgEnvURL {
+		t.Errorf("expected url %v but got %v", pgEnvURL, cfg.URL)
+	}
+	t.Setenv("DATABASE_URL", "postgres://env@localhost/test")
+	cfg, err = parseConfig(t, "-dir", "migrations", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://env@localhost/test"; cfg.URL != want {
+		t.Errorf("expected url %v but got %v", want, cfg.URL)
+	}
+}
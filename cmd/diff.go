@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gosidekick/migration/v3"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	commands = append(commands, diffCmd)
+}
+
+var diffCmd = cli.Command{
+	Name:      "diff",
+	Usage:     "Print a draft migration with the tables and columns of a schema file missing in the database or in an older schema file",
+	ArgsUsage: "[old.sql] new.sql",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "url",
+			Usage:  "DB URL compared with new.sql, instead of old.sql",
+			EnvVar: "DATABASE_URL",
+		},
+		cli.StringFlag{
+			Name:   "table",
+			Usage:  "Migrations table left out of the database schema",
+			EnvVar: "MIGRATIONS_TABLE",
+		},
+		cli.StringFlag{
+			Name:  "schema",
+			Usage: "PostgreSQL schema compared instead of the default search_path",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		var opts []migration.Option
+		if c.String("table") != "" {
+			opts = append(opts, migration.TableName(c.String("table")))
+		}
+		if c.String("schema") != "" {
+			opts = append(opts, migration.Schema(c.String("schema")))
+		}
+		return diffSchemas(context.Background(), c.App.Writer, c.String("url"), c.Args(), opts)
+	},
+}
+
+// diffSchemas prints the statements that migrate the database of dbURL,
+// or the old schema file, to the new schema file
+func diffSchemas(ctx context.Context, w io.Writer, dbURL string, files []string, opts []migration.Option) (err error) {
+	var (
+		current *migration.Snapshot
+		from    string
+	)
+	switch {
+	case len(files) == 1 && dbURL != "":
+		from = "the database"
+		current, err = migration.ReadSnapshot(ctx, dbURL, opts...)
+	case len(files) == 2 && dbURL == "":
+		from = files[0]
+		current, err = readSnapshot(files[0])
+	default:
+		return errors.New("diff compares new.sql with the database of -url or with old.sql")
+	}
+	if err != nil {
+		return
+	}
+	to := files[len(files)-1]
+	target, err := readSnapshot(to)
+	if err != nil {
+		return
+	}
+	statements := migration.Diff(current, target)
+	fmt.Fprintf(w, "-- draft migration from %v to %v, review it before adding it to the migrations\n", from, to)
+	if len(statements) == 0 {
+		fmt.Fprintln(w, "-- no changes")
+		return
+	}
+	fmt.Fprintf(w, "\n%v\n", strings.Join(statements, "\n\n"))
+	return
+}
+
+// readSnapshot parse the tables of a schema file
+func readSnapshot(file string) (*migration.Snapshot, error) {
+	f, err := os.Open(file) // nolint
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint
+	s, err := migration.ParseSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_diffSchemas(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.sql")
+	new := filepath.Join(dir, "new.sql")
+	err := os.WriteFile(old, []byte("CREATE TABLE users (id int);"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(new, []byte("CREATE TABLE users (id int, email text);\nCREATE TABLE orders (id int);"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = diffSchemas(context.Background(), &out, "", []string{old, new}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"-- draft migration", "ALTER TABLE users ADD COLUMN email text;", "CREATE TABLE orders (id int);"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in the output %q", s, out.String())
+		}
+	}
+
+	err = diffSchemas(context.Background(), &out, "", []string{new}, nil)
+	if err == nil {
+		t.Error("expected an error without -url and old.sql")
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// dotEnvFile is loaded from the working directory when it exists
+const dotEnvFile = ".env"
+
+// loadDotEnv read KEY=VALUE lines from path and set the environment
+// variables that are not already set, a missing file is ignored
+func loadDotEnv(path string) error {
+	f, err := os.Open(path) // nolint
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("invalid line %v in %v", n, path)
+		}
+		val = unquote(strings.TrimSpace(val))
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		err = os.Setenv(key, val)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// unquote removes the single or double quotes around a .env value
+func unquote(val string) string {
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDotEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(path, []byte(`# local development
+DATABASE_URL="postgres://dotenv@localhost/test"
+export MIGRATIONS=./fixtures
+ACTION='up'
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATABASE_URL", "")
+	os.Unsetenv("DATABASE_URL") // nolint
+	t.Setenv("MIGRATIONS", "")
+	os.Unsetenv("MIGRATIONS") // nolint
+	t.Setenv("ACTION", "down 1")
+	err = loadDotEnv(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(t, "-dir", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://dotenv@localhost/test"; cfg.URL != want {
+		t.Errorf("expected url %v from .env but got %v", want, cfg.URL)
+	}
+	if want := "migrations"; cfg.Dir != want {
+		t.Errorf("expected the -dir flag %v but got %v", want, cfg.Dir)
+	}
+	if want := "down 1"; cfg.Action != want {
+		t.Errorf("expected the environment action %v but got %v", want, cfg.Action)
+	}
+	if want := "./fixtures"; os.Getenv("MIGRATIONS") != want {
+		t.Errorf("expected MIGRATIONS %v but got %v", want, os.Getenv("MIGRATIONS"))
+	}
+	err = loadDotEnv(filepath.Join(t.TempDir(), ".env"))
+	if err != nil {
+		t.Errorf("expected a missing .env to be ignored but got %v", err)
+	}
+}
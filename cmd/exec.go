@@ -2,11 +2,17 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/gosidekick/migration/v3"
 	"github.com/urfave/cli"
@@ -21,69 +27,843 @@ var (
 		Name: "exec",
 		Flags: []cli.Flag{
 			cli.StringFlag{
-				Name:   "url",
-				Usage:  "DB URL",
-				EnvVar: "DATABASE_URL",
+				Name:  "config",
+				Usage: "YAML config file with url, dir, action, table and timeout (default migration.yaml if it exists)",
 			},
 			cli.StringFlag{
-				Name:   "dir",
-				Usage:  "Migrations dir",
-				EnvVar: "MIGRATIONS",
+				Name:  "url",
+				Usage: "DB URL [$DATABASE_URL]",
 			},
 			cli.StringFlag{
-				Name:   "action",
-				Usage:  "Migrations action",
-				EnvVar: "ACTION",
+				Name:  "url-file",
+				Usage: "File with the DB URL, e.g. a mounted secret [$DATABASE_URL_FILE]",
+			},
+			cli.StringFlag{
+				Name:  "dir",
+				Usage: "Migrations dir, a comma separated list for multiple dirs [$MIGRATIONS]",
+			},
+			cli.StringFlag{
+				Name:  "action",
+				Usage: "Migrations action [$ACTION]",
+			},
+			cli.StringFlag{
+				Name:  "script",
+				Usage: "File with the actions to perform in order, one per line, # starts a comment",
+			},
+			cli.BoolFlag{
+				Name:  "sql-stdin",
+				Usage: "Execute the SQL read from stdin in a transaction instead of the migrations",
+			},
+			cli.Int64Flag{
+				Name:  "record-version",
+				Usage: "Version recorded for the SQL read with -sql-stdin, nothing is recorded if 0",
+			},
+			cli.StringFlag{
+				Name:  "schema",
+				Usage: "PostgreSQL schema of the migrations table and objects, sets the search_path",
+			},
+			cli.StringFlag{
+				Name:  "seeds",
+				Usage: "Directory of the seed action files",
+				Value: "seeds",
+			},
+			cli.StringFlag{
+				Name:  "tag",
+				Usage: "Only the migrations with the tag in the name, e.g. billing for 002_billing_invoices.up.sql",
+			},
+			cli.StringFlag{
+				Name:  "table",
+				Usage: "Table that records the executed migrations [$MIGRATIONS_TABLE]",
+				Value: "schema_migrations",
+			},
+			cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Cancel the migration after the timeout, e.g. 5m",
+			},
+			cli.DurationFlag{
+				Name:  "lock-timeout",
+				Usage: "Fail a migration that waits more than the timeout for a table lock, e.g. 10s",
+			},
+			cli.DurationFlag{
+				Name:  "lock-ttl",
+				Usage: "Take over the lock table claimed longer ago than the ttl by a killed run, e.g. 1h",
+			},
+			cli.IntFlag{
+				Name:  "connect-retries",
+				Usage: "Retry the database connection n times before giving up",
+			},
+			cli.DurationFlag{
+				Name:  "connect-backoff",
+				Usage: "Wait before the first connection retry, doubled on each retry",
+				Value: time.Second,
+			},
+			cli.IntFlag{
+				Name:  "max-open-conns",
+				Usage: "Maximum number of open database connections, 0 is unlimited",
+			},
+			cli.IntFlag{
+				Name:  "max-idle-conns",
+				Usage: "Maximum number of idle database connections, 0 keeps the default",
+			},
+			cli.DurationFlag{
+				Name:  "conn-max-lifetime",
+				Usage: "Close the database connections older than the duration, e.g. 5m",
+			},
+			cli.StringFlag{
+				Name:  "sslmode",
+				Usage: "PostgreSQL SSL mode, e.g. require or verify-full",
+			},
+			cli.StringFlag{
+				Name:  "sslcert",
+				Usage: "PostgreSQL client certificate file",
+			},
+			cli.StringFlag{
+				Name:  "sslkey",
+				Usage: "PostgreSQL client key file",
+			},
+			cli.StringFlag{
+				Name:  "sslrootcert",
+				Usage: "PostgreSQL CA certificate file",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "Output format, text, json or jsonl events",
+				Value: "text",
+			},
+			cli.StringFlag{
+				Name:  "metrics-file",
+				Usage: "Write the Prometheus text format metrics of the run to the file",
+			},
+			cli.BoolFlag{
+				Name:  "count-only",
+				Usage: "Status without output, exits with 2 when there are pending migrations",
+			},
+			cli.BoolFlag{
+				Name:  "fast",
+				Usage: "Status comparing only the file versions with the highest recorded version",
+			},
+			cli.BoolFlag{
+				Name:  "fake",
+				Usage: "Record the migrations as executed or reverted without running them",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the migrations SQL without executing",
+			},
+			cli.BoolFlag{
+				Name:   "protect-destructive",
+				Usage:  "Require -confirm for down, force and goto to a lower version",
+				EnvVar: "MIGRATION_PROTECT_DESTRUCTIVE",
+			},
+			cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "Confirm a destructive action blocked by -protect-destructive",
+			},
+			cli.StringFlag{
+				Name:  "before-sql",
+				Usage: "SQL executed in the transaction of the first migration, before it",
+			},
+			cli.StringFlag{
+				Name:  "after-sql",
+				Usage: "SQL executed in the transaction of the last migration, after it",
+			},
+			cli.BoolFlag{
+				Name:  "quiet",
+				Usage: "Print only the errors, the exit code is unchanged",
+			},
+			cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "Print each SQL statement to stderr before executing it",
+			},
+			cli.StringFlag{
+				Name:  "filename-pattern",
+				Usage: "Regexp with a version group to read the version from the file names, e.g. ^V(?P<version>\\d+)__",
+			},
+			cli.StringFlag{
+				Name:  "to-date",
+				Usage: "Execute with up only the timestamp versions at or before the date, e.g. 2024-02-01",
+			},
+			cli.StringFlag{
+				Name:  "version-strategy",
+				Usage: "Version of the file names, sequential (001_name) or timestamp (20240131120000_name)",
+				Value: "sequential",
+			},
+			cli.BoolFlag{
+				Name:  "allow-out-of-order",
+				Usage: "Allow apply and up when lower versions are pending",
+			},
+			cli.BoolFlag{
+				Name:  "baseline-only",
+				Usage: "Record only the baseline version instead of all the versions up to it",
+			},
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "Replace the recorded migrations on baseline",
+			},
+			cli.BoolFlag{
+				Name:  "allow-missing",
+				Usage: "Allow force to a version without migration file",
+			},
+			cli.StringSliceFlag{
+				Name:  "var",
+				Usage: "Value of the .sql.tmpl migration templates as key=value, can be repeated",
+			},
+			cli.BoolFlag{
+				Name:  "expand-env",
+				Usage: "Replace ${NAME} in the migrations with the environment variable NAME",
+			},
+			cli.BoolFlag{
+				Name:  "recursive",
+				Usage: "Search the migration files in the subdirectories of dir too",
+			},
+			cli.BoolFlag{
+				Name:  "split-statements",
+				Usage: "Execute each statement of the migration files separately",
+			},
+			cli.BoolFlag{
+				Name:  "strict-checksums",
+				Usage: "Fail when an executed migration file was changed",
+			},
+			cli.BoolFlag{
+				Name:  "require-down",
+				Usage: "Fail before up when a pending migration has no down file",
+			},
+			cli.BoolFlag{
+				Name:  "per-migration-tx",
+				Usage: "Commit each migration in its own transaction, a failure keeps the migrations executed before it",
+			},
+			cli.BoolFlag{
+				Name:  "no-color",
+				Usage: "Disable colors in the output, also disabled by NO_COLOR",
 			},
 		},
 		Action: migrate,
 	}
 )
 
+// shutdownTimeout is how long an interrupted migration has to roll back
+const shutdownTimeout = 10 * time.Second
+
 func migrate(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
 	var (
-		dir    = c.String("dir")
-		action = c.String("action")
-		dbURL  = c.String("url")
+		dir    = cfg.Dir
+		action = strings.TrimSpace(cfg.Action)
+		dbURL  = cfg.URL
+		format = c.String("format")
+		dryRun = c.Bool("dry-run")
+		out    = c.App.Writer
+		opts   []migration.Option
 	)
+	if action == "" && !cfg.Stdin && cfg.Script == "" {
+		return migration.ErrEmptyAction
+	}
+	if date := c.String("to-date"); date != "" {
+		if action != "up" {
+			return fmt.Errorf("-to-date can only be used with up, not %q", action)
+		}
+		action = "up-to-date " + date
+	}
+	if c.Bool("fast") {
+		if action != "status" {
+			return fmt.Errorf("-fast can only be used with status, not %q", action)
+		}
+		action = "status fast"
+	}
+	noColor = c.Bool("no-color")
+	if c.Bool("quiet") {
+		// the errors are returned and printed by main
+		out = io.Discard
+		opts = append(opts, migration.Warnings(io.Discard))
+	}
+	if format != "text" && format != "json" && format != "jsonl" {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	if cfg.Table != "" {
+		opts = append(opts, migration.TableName(cfg.Table))
+	}
+	if d := c.Duration("lock-timeout"); d > 0 {
+		opts = append(opts, migration.LockTimeout(d))
+	}
+	if d := c.Duration("lock-ttl"); d > 0 {
+		opts = append(opts, migration.LockTTL(d))
+	}
+	if n := c.Int("connect-retries"); n > 0 {
+		opts = append(opts, migration.ConnectRetries(n), migration.ConnectBackoff(c.Duration("connect-backoff")))
+	}
+	opts = append(opts, migration.WithPool(migration.PoolConfig{
+		MaxOpenConns:    c.Int("max-open-conns"),
+		MaxIdleConns:    c.Int("max-idle-conns"),
+		ConnMaxLifetime: c.Duration("conn-max-lifetime"),
+	}))
+	opts = append(opts, migration.WithSSL(migration.SSLConfig{
+		Mode:     c.String("sslmode"),
+		Cert:     c.String("sslcert"),
+		Key:      c.String("sslkey"),
+		RootCert: c.String("sslrootcert"),
+	}))
+	if c.Bool("protect-destructive") {
+		opts = append(opts, migration.ProtectDestructive())
+	}
+	if c.Bool("confirm") {
+		opts = append(opts, migration.ConfirmDestructive())
+	}
+	if sql := c.String("before-sql"); sql != "" {
+		opts = append(opts, migration.BeforeAll(migration.SQLHook(sql)))
+	}
+	if sql := c.String("after-sql"); sql != "" {
+		opts = append(opts, migration.AfterAll(migration.SQLHook(sql)))
+	}
+	if c.Bool("verbose") {
+		opts = append(opts, migration.Verbose(os.Stderr))
+	}
+	switch s := c.String("version-strategy"); s {
+	case "sequential":
+	case "timestamp":
+		opts = append(opts, migration.WithVersionStrategy(migration.TimestampStrategy{}))
+	default:
+		return fmt.Errorf("unknown version strategy %q", s)
+	}
+	if p := c.String("filename-pattern"); p != "" {
+		s, err := migration.NewPatternStrategy(p)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, migration.WithVersionStrategy(s))
+	}
+	if c.Bool("allow-out-of-order") {
+		opts = append(opts, migration.AllowOutOfOrder())
+	}
+	if c.Bool("fake") {
+		opts = append(opts, migration.Fake())
+	}
+	if c.String("schema") != "" {
+		opts = append(opts, migration.Schema(c.String("schema")))
+	}
+	if c.String("tag") != "" {
+		opts = append(opts, migration.Tag(c.String("tag")))
+	}
+	if c.IsSet("seeds") {
+		opts = append(opts, migration.SeedsDir(c.String("seeds")))
+	}
+	if c.Bool("baseline-only") {
+		opts = append(opts, migration.BaselineOnly())
+	}
+	if c.Bool("force") {
+		opts = append(opts, migration.ForceBaseline())
+	}
+	if c.Bool("allow-missing") {
+		opts = append(opts, migration.AllowMissing())
+	}
+	if c.Bool("expand-env") {
+		opts = append(opts, migration.ExpandVars(nil))
+	}
+	if vars := c.StringSlice("var"); len(vars) > 0 {
+		m, err := templateVars(vars)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, migration.TemplateVars(m))
+	}
+	if c.Bool("recursive") {
+		opts = append(opts, migration.Recursive())
+	}
+	if c.Bool("split-statements") {
+		opts = append(opts, migration.SplitStatements())
+	}
+	if c.Bool("strict-checksums") {
+		opts = append(opts, migration.StrictChecksums())
+	}
+	if c.Bool("require-down") {
+		opts = append(opts, migration.RequireDown())
+	}
+	if c.Bool("per-migration-tx") {
+		opts = append(opts, migration.PerMigrationTx())
+	}
+	if dryRun {
+		w := out
+		if format != "text" && !c.Bool("quiet") {
+			w = os.Stderr
+		}
+		opts = append(opts, migration.DryRun(w))
+	}
+	durations := map[string]time.Duration{}
+	opts = append(opts, migration.OnApplied(func(file string, d time.Duration) {
+		durations[file] = d
+	}))
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	echan := make(chan struct{}, 1)
-	cerr := make(chan error, 1)
-	go func(ctx context.Context) {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		signal.Notify(sigint, syscall.SIGTERM)
-		<-sigint
-		fmt.Fprintln(c.App.Writer, "exiting")
-		echan <- struct{}{}
-	}(ctx)
+	if cfg.Timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, cfg.Timeout)
+		defer stop()
+	}
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigint)
+	done := make(chan error, 1)
+	start := time.Now()
 	go func(ctx context.Context) {
-		n, executed, err := migration.Run(ctx, dir, dbURL, action)
-		switch strings.Fields(action)[0] {
-		case "status":
-			fmt.Fprintf(c.App.Writer, "check migrations located in %v\n", dir)
-			fmt.Fprintf(c.App.Writer, "%v needs to be executed\n", n)
-			for _, e := range executed {
-				fmt.Fprintf(c.App.Writer, "%v\n", e)
+		defer func() {
+			if r := recover(); r != nil {
+				done <- panicError(r)
 			}
-		case "up", "down":
-			fmt.Fprintf(c.App.Writer, "exec migrations located in %v\n", dir)
-			fmt.Fprintf(c.App.Writer, "executed %v migrations\n", n)
-			for _, e := range executed {
-				fmt.Fprintf(c.App.Writer, "%v SUCCESS\n", e)
+		}()
+		if cfg.Stdin {
+			w := out
+			if format != "text" {
+				w = io.Discard
 			}
+			done <- execStdin(ctx, os.Stdin, w, dbURL, c.Int64("record-version"), opts)
+			return
 		}
-		if err != nil {
-			cerr <- err
+		if cfg.Script != "" {
+			done <- runScript(ctx, out, format, dir, dbURL, cfg.Script, opts)
+			return
+		}
+		if c.Bool("count-only") && strings.Fields(action)[0] == "status" {
+			done <- countOnly(ctx, dir, dbURL, action, opts)
+			return
+		}
+		switch format {
+		case "json":
+			done <- runJSON(ctx, out, dir, dbURL, action, opts)
+			return
+		case "jsonl":
+			done <- runJSONL(ctx, out, dir, dbURL, action, opts)
 			return
 		}
-		echan <- struct{}{}
+		done <- runText(ctx, out, dir, dbURL, action, dryRun, c.Bool("fake"), durations, opts)
 	}(ctx)
 	select {
-	case err := <-cerr:
-		return err
-	case <-echan:
+	case err := <-done:
+		return reportRun(c.String("metrics-file"), dir, dbURL, start, len(durations), err, opts)
+	case <-sigint:
+	}
+	// cancel the context so the running transaction is rolled back
+	// and wait for the migration to stop before exiting
+	if format == "text" {
+		fmt.Fprintln(out, "exiting")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		return reportRun(c.String("metrics-file"), dir, dbURL, start, len(durations), err, opts)
+	case <-time.After(shutdownTimeout):
+		return fmt.Errorf("migration still running %v after the interrupt", shutdownTimeout)
+	}
+}
+
+func runText(ctx context.Context, w io.Writer, dir, dbURL, action string, dryRun, fake bool, durations map[string]time.Duration, opts []migration.Option) error {
+	if strings.Fields(action)[0] == "doctor" {
+		return doctor(ctx, w, dir, dbURL, opts)
+	}
+	if strings.Fields(action)[0] == "force" {
+		before, after, err := force(ctx, dir, dbURL, action, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "force migrations located in %v\n", dir)
+		fmt.Fprintf(w, "recorded version changed from %v to %v\n", before, after)
+		return nil
+	}
+	if strings.Fields(action)[0] == "version" {
+		v, file, err := migration.Version(ctx, dir, dbURL, opts...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%v", v)
+		if file != "" {
+			fmt.Fprintf(w, " %v", file)
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+	if strings.Fields(action)[0] == "list" {
+		l, err := migration.List(ctx, dir, dbURL, opts...)
+		if err != nil {
+			return err
+		}
+		printList(w, l)
+		return nil
+	}
+	if strings.Fields(action)[0] == "history" {
+		h, err := migration.History(ctx, dir, dbURL, newestFirst(action), opts...)
+		if err != nil {
+			return err
+		}
+		printHistory(w, h)
+		return nil
+	}
+	if action == "status fast" {
+		n, files, err := migration.Run(ctx, dir, dbURL, action, opts...)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			fmt.Fprintln(w, "up to date")
+			return nil
+		}
+		fmt.Fprintf(w, "%v newer than the database needs to be executed\n", n)
+		for _, f := range files {
+			fmt.Fprintf(w, "%v\n", f)
+		}
+		return nil
+	}
+	if strings.Fields(action)[0] == "status" {
+		r, err := migration.Report(ctx, dir, dbURL, opts...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "check migrations located in %v\n", dir)
+		for _, h := range r.History {
+			applied := "unknown"
+			if h.AppliedAt != nil {
+				applied = h.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if h.Name != "" {
+				fmt.Fprintf(w, "version %v %v applied at %v\n", h.Version, h.Name, applied)
+				continue
+			}
+			fmt.Fprintf(w, "version %v applied at %v\n", h.Version, applied)
+		}
+		fmt.Fprintf(w, "%v needs to be executed\n", len(r.Pending))
+		for _, p := range r.Pending {
+			fmt.Fprintf(w, "%v\n", p.File)
+		}
+		if len(r.Orphaned) > 0 {
+			fmt.Fprintf(w, "%v orphaned applied versions have no migration file\n", len(r.Orphaned))
+			for _, v := range r.Orphaned {
+				fmt.Fprintf(w, "version %v\n", v)
+			}
+		}
+		return nil
+	}
+	n, executed, err := migration.Run(ctx, dir, dbURL, action, opts...)
+	switch strings.Fields(action)[0] {
+	case "pending":
+		for _, e := range executed {
+			fmt.Fprintf(w, "%v\n", e)
+		}
+	case "verify":
+		if err == nil {
+			fmt.Fprintf(w, "no drift in migrations located in %v\n", dir)
+			break
+		}
+		for _, e := range executed {
+			fmt.Fprintf(w, "%v %v\n", e, colorize("DRIFTED", colorRed))
+		}
+	case "plan":
+		fmt.Fprintf(w, "plan of migrations located in %v, rolled back\n", dir)
+		for _, e := range executed {
+			fmt.Fprintf(w, "%v %v\n", e, colorize("OK", colorGreen))
+		}
+		var merr *migration.MigrationError
+		if errors.As(err, &merr) {
+			fmt.Fprintf(w, "%v %v\n", merr.File(), colorize("FAILED", colorRed))
+		}
+	case "unlock":
+		if err == nil {
+			fmt.Fprintln(w, "migration lock released")
+		}
+	case "seed":
+		if err != nil {
+			break
+		}
+		fmt.Fprintf(w, "executed %v seed files\n", n)
+		for _, e := range executed {
+			fmt.Fprintf(w, "%v\n", e)
+		}
+	case "baseline":
+		if err != nil {
+			break
+		}
+		fmt.Fprintf(w, "baseline of migrations located in %v\n", dir)
+		fmt.Fprintf(w, "recorded %v migrations without executing\n", n)
+		for _, e := range executed {
+			fmt.Fprintf(w, "%v\n", e)
+		}
+	case "up", "down", "goto", "up-to", "up-to-date", "apply", "run":
+		if dryRun {
+			fmt.Fprintf(w, "dry run of migrations located in %v\n", dir)
+			fmt.Fprintf(w, "%v migrations would be executed\n", n)
+			break
+		}
+		if fake && err == nil {
+			fmt.Fprintf(w, "fake migrations located in %v\n", dir)
+			fmt.Fprintf(w, "recorded %v migrations without executing\n", n)
+			for _, e := range executed {
+				fmt.Fprintf(w, "%v\n", e)
+			}
+			break
+		}
+		fmt.Fprintf(w, "exec migrations located in %v\n", dir)
+		fmt.Fprintf(w, "executed %v migrations\n", n)
+		var total time.Duration
+		for _, e := range executed {
+			total += durations[e]
+			fmt.Fprintf(w, "%v (%v) %v\n", e, formatDuration(durations[e]), colorize("SUCCESS", colorGreen))
+		}
+		var merr *migration.MigrationError
+		if errors.As(err, &merr) {
+			fmt.Fprintf(w, "%v %v\n", merr.File(), colorize("FAILED", colorRed))
+		}
+		fmt.Fprintf(w, "total %v\n", formatDuration(total))
+	}
+	return err
+}
+
+func runJSON(ctx context.Context, w io.Writer, dir, dbURL, action string, opts []migration.Option) error {
+	var v interface{}
+	switch strings.Fields(action)[0] {
+	case "doctor":
+		type check struct {
+			Name  string `json:"name"`
+			Error string `json:"error,omitempty"`
+		}
+		checks := []check{}
+		var failed int
+		for _, c := range migration.Doctor(ctx, dir, dbURL, opts...) {
+			r := check{Name: c.Name}
+			if c.Err != nil {
+				r.Error = c.Err.Error()
+				failed++
+			}
+			checks = append(checks, r)
+		}
+		err := json.NewEncoder(w).Encode(checks)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("doctor found %v problems", failed)
+		}
 		return nil
+	case "status":
+		if action == "status fast" {
+			_, pending, err := migration.Run(ctx, dir, dbURL, action, opts...)
+			if err != nil {
+				return err
+			}
+			if pending == nil {
+				pending = []string{}
+			}
+			v = struct {
+				Pending []string `json:"pending"`
+			}{pending}
+			break
+		}
+		r, err := migration.Report(ctx, dir, dbURL, opts...)
+		if err != nil {
+			return err
+		}
+		v = r
+	case "list":
+		l, err := migration.List(ctx, dir, dbURL, opts...)
+		if err != nil {
+			return err
+		}
+		v = l
+	case "history":
+		h, err := migration.History(ctx, dir, dbURL, newestFirst(action), opts...)
+		if err != nil {
+			return err
+		}
+		v = h
+	case "force":
+		before, after, err := force(ctx, dir, dbURL, action, opts)
+		if err != nil {
+			return err
+		}
+		v = struct {
+			Before int64 `json:"before"`
+			After  int64 `json:"after"`
+		}{before, after}
+	case "version":
+		n, file, err := migration.Version(ctx, dir, dbURL, opts...)
+		if err != nil {
+			return err
+		}
+		v = struct {
+			Version int64  `json:"version"`
+			File    string `json:"file,omitempty"`
+		}{n, file}
+	case "pending":
+		_, pending, err := migration.Run(ctx, dir, dbURL, action, opts...)
+		if err != nil {
+			return err
+		}
+		if pending == nil {
+			pending = []string{}
+		}
+		v = struct {
+			Pending []string `json:"pending"`
+		}{pending}
+	default:
+		n, executed, err := migration.Run(ctx, dir, dbURL, action, opts...)
+		var merr *migration.MigrationError
+		if err != nil && !errors.As(err, &merr) {
+			return err
+		}
+		if executed == nil {
+			executed = []string{}
+		}
+		var failed string
+		if merr != nil {
+			failed = merr.File()
+		}
+		encErr := json.NewEncoder(w).Encode(struct {
+			Executed int      `json:"executed"`
+			Files    []string `json:"files"`
+			Failed   string   `json:"failed,omitempty"`
+		}{n, executed, failed})
+		if err != nil {
+			return err
+		}
+		return encErr
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+// templateVars parse the key=value pairs of the -var flags
+func templateVars(vars []string) (map[string]string, error) {
+	m := make(map[string]string, len(vars))
+	for _, kv := range vars {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid -var %q, use key=value", kv)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// runScript performs the actions of the script file and prints
+// the result of each action
+func runScript(ctx context.Context, w io.Writer, format, dir, dbURL, script string, opts []migration.Option) error {
+	f, err := os.Open(script) // nolint
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint
+	steps, err := migration.RunScript(ctx, dir, dbURL, f, opts...)
+	if format != "text" {
+		if steps == nil {
+			steps = []migration.ScriptStep{}
+		}
+		if jerr := json.NewEncoder(w).Encode(steps); jerr != nil && err == nil {
+			err = jerr
+		}
+		return err
+	}
+	for _, s := range steps {
+		fmt.Fprintf(w, "%v: %v\n", s.Action, s.Number)
+		for _, file := range s.Executed {
+			fmt.Fprintf(w, "\t%v\n", file)
+		}
+	}
+	return err
+}
+
+// execStdin executes the SQL read from r and records version if not 0
+func execStdin(ctx context.Context, r io.Reader, w io.Writer, dbURL string, version int64, opts []migration.Option) error {
+	err := migration.ExecSQL(ctx, dbURL, r, version, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "executed SQL from stdin")
+	if version != 0 {
+		fmt.Fprintf(w, "recorded version %v\n", version)
+	}
+	return nil
+}
+
+// printList writes the migrations as an aligned table
+func printList(w io.Writer, l []migration.ListedMigration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+	for _, e := range l {
+		status := colorize("pending", colorYellow)
+		if e.Applied {
+			status = colorize("applied", colorGreen)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", e.Version, e.Name, status)
+	}
+	tw.Flush() // nolint
+}
+
+// newestFirst report if the action is history newest
+func newestFirst(action string) bool {
+	f := strings.Fields(action)
+	return len(f) == 2 && f[0] == "history" && f[1] == "newest"
+}
+
+// printHistory writes the executed migrations with the time they
+// were applied, unknown for the ones executed before it was recorded
+func printHistory(w io.Writer, h []migration.HistoryEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+	for _, e := range h {
+		applied := "unknown"
+		if e.AppliedAt != nil {
+			applied = e.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", e.Version, e.Name, applied)
+	}
+	tw.Flush() // nolint
+}
+
+// countOnly return ErrPending when there are pending migrations
+func countOnly(ctx context.Context, dir, dbURL, action string, opts []migration.Option) error {
+	n, _, err := migration.Run(ctx, dir, dbURL, action, opts...)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrPending
+	}
+	return nil
+}
+
+// doctor prints the result of each migration.Doctor check
+func doctor(ctx context.Context, w io.Writer, dir, dbURL string, opts []migration.Option) error {
+	var failed int
+	for _, c := range migration.Doctor(ctx, dir, dbURL, opts...) {
+		if c.Err != nil {
+			failed++
+			fmt.Fprintf(w, "%v %v: %v\n", colorize("FAIL", colorRed), c.Name, c.Err)
+			continue
+		}
+		fmt.Fprintf(w, "%v %v\n", colorize("PASS", colorGreen), c.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("doctor found %v problems", failed)
+	}
+	return nil
+}
+
+func force(ctx context.Context, dir, dbURL, action string, opts []migration.Option) (before, after int64, err error) {
+	m := strings.Fields(action)
+	if len(m) != 2 {
+		err = fmt.Errorf("force %w", migration.ErrMissingVersion)
+		return
+	}
+	v, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid force version %q", m[1])
+		return
+	}
+	return migration.Force(ctx, dir, dbURL, v, opts...)
+}
+
+// formatDuration rounds d to milliseconds, or to microseconds
+// when it is shorter than a millisecond
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
 	}
+	return d.Round(time.Millisecond).String()
 }
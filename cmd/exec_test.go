@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gosidekick/migration/v3"
+	"github.com/urfave/cli"
+)
+
+func TestMigrateQuiet(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "001_a.up.sql"), []byte("CREATE TABLE a (id int);"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "001_a.down.sql"), []byte("DROP TABLE a;"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &out
+	app.Commands = []cli.Command{execCmd}
+	err = app.Run([]string{"migration", "exec", "-quiet", "-url", url, "-dir", dir, "-action", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output but got %q", out.String())
+	}
+	_, pending, err := migration.Run(context.Background(), dir, url, "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected the migrations executed but %v are pending", pending)
+	}
+}
+
+func TestMigrateFastStatus(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "001_a.up.sql"), []byte("CREATE TABLE a (id int);"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		app := cli.NewApp()
+		app.Writer = &out
+		app.Commands = []cli.Command{execCmd}
+		err := app.Run(append([]string{"migration", "exec", "-url", url, "-dir", dir}, args...))
+		return out.String(), err
+	}
+	out, err := run("-fast", "-action", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "1 newer than the database needs to be executed") {
+		t.Errorf("expected the gap in the output %q", out)
+	}
+	_, err = run("-fast", "-action", "up")
+	if err == nil || !strings.Contains(err.Error(), "-fast can only be used with status") {
+		t.Errorf("expected an error for -fast with up but got %v", err)
+	}
+}
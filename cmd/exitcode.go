@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/gosidekick/migration/v3"
+	"github.com/urfave/cli"
+)
+
+// ErrPending is returned by status with -count-only when there
+// are pending migrations
+var ErrPending = errors.New("there are pending migrations")
+
+// errPanic is returned for a panic recovered while migrating
+var errPanic = errors.New("panic")
+
+// Exit codes of the migration command, the panics and the usage
+// errors of the command line exit with ExitError, only the fatal
+// errors of the Go runtime, e.g. out of memory, still exit with 2
+const (
+	ExitOK         = 0
+	ExitError      = 1
+	ExitPending    = 2
+	ExitValidation = 3
+	ExitConnection = 4
+)
+
+// validationErrors are the errors of migration files or of a
+// migrations table that fail the checks before anything is executed
+var validationErrors = []error{
+	migration.ErrInvalidVersion,
+	migration.ErrInvalidMigrationFile,
+	migration.ErrDuplicateVersion,
+	migration.ErrMissingDownFile,
+	migration.ErrMissingUpFile,
+	migration.ErrOutOfOrder,
+	migration.ErrChecksumMismatch,
+	migration.ErrDrift,
+	migration.ErrIncompatibleTable,
+}
+
+// connectionErrors are the errors of a database that can't be reached
+var connectionErrors = []error{
+	migration.ErrOpenDatabase,
+	migration.ErrPingDatabase,
+}
+
+// ExitCode return the process exit code for the error returned by Execute
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrPending):
+		return ExitPending
+	case isUsage(err):
+		return ExitError
+	case isAny(err, connectionErrors):
+		return ExitConnection
+	case isAny(err, validationErrors):
+		return ExitValidation
+	}
+	return ExitError
+}
+
+// isUsage report if err is a command line error of urfave/cli,
+// e.g. an unknown help topic, they have their own exit codes
+func isUsage(err error) bool {
+	var ec cli.ExitCoder
+	return errors.As(err, &ec)
+}
+
+// panicError return the error of a recovered panic with its stack
+func panicError(r interface{}) error {
+	return fmt.Errorf("%w: %v\n%s", errPanic, r, debug.Stack())
+}
+
+// isAny report if err is one of targets
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gosidekick/migration/v3"
+	"github.com/urfave/cli"
+	// sqlite driver for tests
+	_ "modernc.org/sqlite"
+)
+
+func TestCountOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	opts := []migration.Option{migration.WithFS(fsys)}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	err := countOnly(ctx, "migrations", url, "status", opts)
+	if code := ExitCode(err); code != ExitPending {
+		t.Errorf("expected exit code %v with pending migrations but got %v (%v)", ExitPending, code, err)
+	}
+	_, _, err = migration.Run(ctx, "migrations", url, "up", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = countOnly(ctx, "migrations", url, "status", opts)
+	if code := ExitCode(err); code != ExitOK {
+		t.Errorf("expected exit code %v when up to date but got %v (%v)", ExitOK, code, err)
+	}
+	if code := ExitCode(errors.New("connection refused")); code != ExitError {
+		t.Errorf("expected exit code %v for an error but got %v", ExitError, code)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", want: ExitOK},
+		{name: "pending", err: ErrPending, want: ExitPending},
+		{name: "unexpected", err: errors.New("syntax error at or near"), want: ExitError},
+		{name: "checksum", err: fmt.Errorf("001_a.up.sql: %w", migration.ErrChecksumMismatch), want: ExitValidation},
+		{name: "drift", err: migration.ErrDrift, want: ExitValidation},
+		{name: "missing down", err: fmt.Errorf("%w for 002_b.up.sql", migration.ErrMissingDownFile), want: ExitValidation},
+		{name: "open", err: fmt.Errorf("%w: unknown driver", migration.ErrOpenDatabase), want: ExitConnection},
+		{name: "ping", err: fmt.Errorf("%w: connection refused", migration.ErrPingDatabase), want: ExitConnection},
+		{name: "usage", err: cli.NewExitError("No help topic for 'x'", 3), want: ExitError},
+		{name: "panic", err: panicError("slice bounds out of range"), want: ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":     {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_other.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+	}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := migration.Run(ctx, "migrations", url, "up", migration.WithFS(fsys))
+	if code := ExitCode(err); code != ExitValidation {
+		t.Errorf("expected exit code %v for a duplicate version but got %v (%v)", ExitValidation, code, err)
+	}
+	delete(fsys, "migrations/001_other.up.sql")
+	url = "sqlite://" + filepath.Join(t.TempDir(), "missing", "test.db")
+	_, _, err = migration.Run(ctx, "migrations", url, "up", migration.WithFS(fsys))
+	if code := ExitCode(err); code != ExitConnection {
+		t.Errorf("expected exit code %v for a database that can't be opened but got %v (%v)", ExitConnection, code, err)
+	}
+}
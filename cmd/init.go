@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+)
+
+func init() {
+	commands = append(commands, initCmd)
+}
+
+var initCmd = cli.Command{
+	Name:  "init",
+	Usage: "Create the migrations directory with a sample migration",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "dir",
+			Usage:  "Migrations dir",
+			Value:  defaultMigrationsDir,
+			EnvVar: "MIGRATIONS",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		return initMigrations(c.App.Writer, c.String("dir"))
+	},
+}
+
+// sampleMigrations are the files written by init
+var sampleMigrations = []struct {
+	name    string
+	content string
+}{
+	{
+		name: "001_initial.up.sql",
+		content: `-- 001_initial.up.sql is executed by "migration up" in a transaction,
+-- the version is the number before the first underscore and the
+-- files are executed in version order, e.g. 002_add_users.up.sql next
+--
+-- CREATE TABLE example (
+--     id serial PRIMARY KEY,
+--     name text NOT NULL
+-- );
+`,
+	},
+	{
+		name: "001_initial.down.sql",
+		content: `-- 001_initial.down.sql reverts 001_initial.up.sql with "migration down",
+-- each up file needs a down file with the same version
+--
+-- DROP TABLE example;
+`,
+	},
+}
+
+// initMigrations creates dir and the sample migrations, the
+// existing files are never replaced
+func initMigrations(w io.Writer, dir string) error {
+	for _, f := range sampleMigrations {
+		_, err := os.Stat(filepath.Join(dir, f.name))
+		if err == nil {
+			return fmt.Errorf("%v already exists", filepath.Join(dir, f.name))
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	err := os.MkdirAll(dir, 0o755) // nolint
+	if err != nil {
+		return err
+	}
+	for _, f := range sampleMigrations {
+		path := filepath.Join(dir, f.name)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644) // nolint
+		if err != nil {
+			return err
+		}
+		_, err = file.WriteString(f.content)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "created %v\n", path)
+	}
+	fmt.Fprintf(w, `
+next steps:
+  edit %[1]v and %[2]v
+  migration exec -url "postgres://user@localhost:5432/dbname?sslmode=disable" -dir %[3]v -action up
+`, filepath.Join(dir, sampleMigrations[0].name), filepath.Join(dir, sampleMigrations[1].name), dir)
+	return nil
+}
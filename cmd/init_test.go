@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_initMigrations(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db", "migrations")
+	var out bytes.Buffer
+	err := initMigrations(&out, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range sampleMigrations {
+		b, err := os.ReadFile(filepath.Join(dir, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != f.content {
+			t.Errorf("expected %v with the sample content but got %q", f.name, b)
+		}
+		if !strings.Contains(out.String(), "created "+filepath.Join(dir, f.name)) {
+			t.Errorf("expected %v in the output %q", f.name, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "next steps") {
+		t.Errorf("expected the next steps in the output %q", out.String())
+	}
+
+	up := filepath.Join(dir, "001_initial.up.sql")
+	err = os.WriteFile(up, []byte("CREATE TABLE users (id int);"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = initMigrations(&out, dir)
+	if err == nil {
+		t.Error("expected init to refuse existing files")
+	}
+	b, _ := os.ReadFile(up)
+	if string(b) != "CREATE TABLE users (id int);" {
+		t.Errorf("expected the existing file unchanged but got %q", b)
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gosidekick/migration/v3"
+)
+
+// jsonlEvents maps the migration log messages to event names
+var jsonlEvents = map[string]string{
+	"migration applied":         "applied",
+	"migration already applied": "skipped",
+	"migration failed":          "failed",
+}
+
+// jsonlLogger is a migration.Logger that writes each entry as a JSON
+// line event as soon as it happens
+type jsonlLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *jsonlLogger) event(name string, kv ...any) {
+	e := map[string]any{"event": name, "time": time.Now().UTC().Format(time.RFC3339Nano)}
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		switch v := kv[i+1].(type) {
+		case time.Duration:
+			e[key+"_ms"] = float64(v) / float64(time.Millisecond)
+		case error:
+			e[key] = v.Error()
+		default:
+			e[key] = v
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	json.NewEncoder(l.w).Encode(e) // nolint
+}
+
+func (l *jsonlLogger) log(level, msg string, kv ...any) {
+	name, ok := jsonlEvents[msg]
+	if !ok {
+		name = level
+		kv = append([]any{"message", msg}, kv...)
+	}
+	l.event(name, kv...)
+}
+
+func (l *jsonlLogger) Info(msg string, kv ...any)  { l.log("info", msg, kv...) }
+func (l *jsonlLogger) Warn(msg string, kv ...any)  { l.log("warning", msg, kv...) }
+func (l *jsonlLogger) Error(msg string, kv ...any) { l.log("error", msg, kv...) }
+
+// runJSONL runs the action writing start, applied, failed, error and
+// done events to w as JSON lines
+func runJSONL(ctx context.Context, w io.Writer, dir, dbURL, action string, opts []migration.Option) error {
+	l := &jsonlLogger{w: w}
+	l.event("start", "action", action, "dir", dir)
+	n, files, err := migration.Run(ctx, dir, dbURL, action, append(opts, migration.WithLogger(l))...)
+	if err != nil {
+		l.event("error", "error", err)
+		return err
+	}
+	if files == nil {
+		files = []string{}
+	}
+	l.event("done", "executed", n, "files", files)
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gosidekick/migration/v3"
+)
+
+func TestRunJSONL(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	var buf bytes.Buffer
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	err := runJSONL(context.Background(), &buf, "migrations", url, "up", []migration.Option{migration.WithFS(fsys)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	var files []any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e map[string]any
+		err = dec.Decode(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e["event"].(string))
+		if e["event"] == "applied" {
+			files = append(files, e["file"])
+			if _, ok := e["duration_ms"].(float64); !ok {
+				t.Errorf("expected the duration in the applied event but got %v", e)
+			}
+		}
+	}
+	if want := []string{"start", "applied", "applied", "applied", "done"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("expected the events %v but got %v", want, events)
+	}
+	if want := []any{"migrations/001_a.up.sql", "migrations/002_b.up.sql", "migrations/003_c.up.sql"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("expected the applied files %v but got %v", want, files)
+	}
+}
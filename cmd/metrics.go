@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gosidekick/migration/v3"
+)
+
+// runMetrics are the results of a run written with -metrics-file
+type runMetrics struct {
+	applied  int
+	version  int64
+	duration time.Duration
+	failed   bool
+	// noVersion is set when the recorded version couldn't be read
+	noVersion bool
+}
+
+// String return the metrics in the Prometheus text format
+func (r runMetrics) String() string {
+	var b strings.Builder
+	metric := func(name, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, kind, name, value)
+	}
+	metric("migrations_applied_total", "counter", "Migrations executed by the run.", r.applied)
+	if !r.noVersion {
+		metric("migration_last_version", "gauge", "Version recorded in the migrations table after the run.", r.version)
+	}
+	metric("migration_run_duration_seconds", "gauge", "Duration of the run.", r.duration.Seconds())
+	failed := 0
+	if r.failed {
+		failed = 1
+	}
+	metric("migration_failed", "gauge", "1 if the run failed, else 0.", failed)
+	return b.String()
+}
+
+// reportRun writes the metrics file of the run when path is
+// set and return the error of the run or of the metrics file
+func reportRun(path, dir, dbURL string, start time.Time, applied int, err error, opts []migration.Option) error {
+	if path == "" {
+		return err
+	}
+	r := runMetrics{applied: applied, duration: time.Since(start), failed: err != nil}
+	v, verr := lastVersion(dir, dbURL, opts)
+	r.version, r.noVersion = v, verr != nil
+	werr := writeMetrics(path, r)
+	if err == nil {
+		err = werr
+	}
+	return err
+}
+
+// lastVersion return the recorded version after the run, it
+// has its own timeout because the run context may be done
+func lastVersion(dir, dbURL string, opts []migration.Option) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	v, _, err := migration.Version(ctx, dir, dbURL, opts...)
+	return v, err
+}
+
+// writeMetrics replace the file at path with the metrics, the
+// file is renamed into place so a scraper never reads it partially
+func writeMetrics(path string, r runMetrics) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(r.String())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name()) // nolint
+		return fmt.Errorf("metrics file: %w", err)
+	}
+	return nil
+}
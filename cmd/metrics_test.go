@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gosidekick/migration/v3"
+)
+
+// readMetrics parse the samples of a Prometheus text format file
+func readMetrics(t *testing.T, path string) map[string]float64 {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	samples := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Fatalf("invalid sample %q", line)
+		}
+		samples[name], err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("invalid sample %q: %v", line, err)
+		}
+	}
+	return samples
+}
+
+func TestReportRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	applied := 0
+	opts := []migration.Option{migration.WithFS(fsys), migration.OnApplied(func(string, time.Duration) {
+		applied++
+	})}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	path := filepath.Join(t.TempDir(), "migration.prom")
+	start := time.Now()
+	_, _, err := migration.Run(context.Background(), "migrations", url, "up", opts...)
+	err = reportRun(path, "migrations", url, start, applied, err, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := readMetrics(t, path)
+	if samples["migrations_applied_total"] != 2 || samples["migration_last_version"] != 2 || samples["migration_failed"] != 0 {
+		t.Errorf("unexpected metrics %v", samples)
+	}
+	if d, ok := samples["migration_run_duration_seconds"]; !ok || d <= 0 {
+		t.Errorf("expected the run duration but got %v", samples)
+	}
+
+	failure := errors.New("migration failed")
+	err = reportRun(path, "migrations", url, time.Now(), 0, failure, opts)
+	if err != failure {
+		t.Errorf("expected the run error but got %v", err)
+	}
+	samples = readMetrics(t, path)
+	if samples["migrations_applied_total"] != 0 || samples["migration_failed"] != 1 {
+		t.Errorf("unexpected metrics after a failure %v", samples)
+	}
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"errors"
+	"os"
+	"runtime/debug"
+
 	"github.com/gosidekick/migration/v3/cmd"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
 	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	if err := cmd.Execute(); err != nil {
-		logrus.Fatal(err)
+	defer func() {
+		// a panic would exit with 2, the code of the pending migrations
+		if r := recover(); r != nil {
+			logrus.Errorf("panic: %v\n%s", r, debug.Stack())
+			os.Exit(cmd.ExitError)
+		}
+	}()
+	err := cmd.Execute()
+	var usage cli.ExitCoder
+	if err != nil && !errors.Is(err, cmd.ErrPending) && !errors.As(err, &usage) {
+		logrus.Error(err)
 	}
+	os.Exit(cmd.ExitCode(err))
 }
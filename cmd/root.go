@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/urfave/cli"
 )
@@ -16,6 +17,10 @@ var (
 
 // Execute starts the migration app CLI
 func Execute() error {
+	err := loadDotEnv(dotEnvFile)
+	if err != nil {
+		return err
+	}
 	app = cli.NewApp()
 	app.EnableBashCompletion = true
 	app.Name = "Migration Tool"
@@ -26,8 +31,34 @@ func Execute() error {
 	cli.VersionFlag = cli.BoolFlag{
 		Name: "version",
 	}
+	// the usage errors are printed by urfave/cli and returned
+	// to main, the exit code is chosen by ExitCode
+	cli.OsExiter = func(int) {}
 	cli.VersionPrinter = func(c *cli.Context) {
 		fmt.Fprintf(c.App.Writer, "Migration tool version=%s\n", c.App.Version)
 	}
-	return app.Run(os.Args)
+	return app.Run(execArgs(os.Args))
+}
+
+// execArgs makes exec the default command, migration -url ... up 1
+// is the same as migration exec -url ... up 1, migration version is
+// the version action and -version the version of the tool
+func execArgs(args []string) []string {
+	if len(args) < 2 {
+		return args
+	}
+	switch args[1] {
+	case "-version", "--version":
+		return args
+	}
+	switch strings.TrimLeft(args[1], "-") {
+	case "help", "h", "generate-bash-completion":
+		return args
+	}
+	for _, c := range commands {
+		if c.HasName(args[1]) {
+			return args
+		}
+	}
+	return append([]string{args[0], "exec"}, args[1:]...)
 }
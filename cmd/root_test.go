@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gosidekick/migration/v3"
+	"github.com/urfave/cli"
+)
+
+func Test_execArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "no args", args: []string{"migration"}, want: []string{"migration"}},
+		{name: "exec", args: []string{"migration", "exec", "up"}, want: []string{"migration", "exec", "up"}},
+		{name: "init", args: []string{"migration", "init"}, want: []string{"migration", "init"}},
+		{name: "action", args: []string{"migration", "up", "1"}, want: []string{"migration", "exec", "up", "1"}},
+		{name: "flags", args: []string{"migration", "-url", "postgres://localhost/test", "up"}, want: []string{"migration", "exec", "-url", "postgres://localhost/test", "up"}},
+		{name: "tool version", args: []string{"migration", "-version"}, want: []string{"migration", "-version"}},
+		{name: "tool version long", args: []string{"migration", "--version"}, want: []string{"migration", "--version"}},
+		{name: "version action", args: []string{"migration", "version"}, want: []string{"migration", "exec", "version"}},
+		{name: "help", args: []string{"migration", "help"}, want: []string{"migration", "help"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("execArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionAction(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "001_a.up.sql"), []byte("CREATE TABLE a (id int);"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err = migration.Run(context.Background(), dir, url, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATABASE_URL", url)
+	t.Setenv("MIGRATIONS", dir)
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &out
+	app.Commands = []cli.Command{execCmd}
+	err = app.Run(execArgs([]string{"migration", "version"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 " + filepath.Join(dir, "001_a.up.sql") + "\n"; out.String() != want {
+		t.Errorf("expected the database version %q but got %q", want, out.String())
+	}
+}
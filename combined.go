@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// markers of the up and down sections of a single file migration
+const (
+	upMarker   = "-- +migration Up"
+	downMarker = "-- +migration Down"
+)
+
+// irreversibleMarker in a down migration blocks down past it
+const irreversibleMarker = "-- migration:irreversible"
+
+// isCombined report if file is a single file migration, NNN_name.sql
+// with both the up and the down sections, globFiles ignores the
+// other .sql files without a version prefix
+func isCombined(file string) bool {
+	file = strings.TrimSuffix(file, templateSuffix)
+	return strings.HasSuffix(file, ".sql") &&
+		!strings.HasSuffix(file, ".up.sql") &&
+		!strings.HasSuffix(file, ".down.sql")
+}
+
+// parseCombined split a single file migration in the up and down SQL,
+// the lines before the first marker are ignored
+func parseCombined(b []byte) (up, down []byte, err error) {
+	var (
+		section *bytes.Buffer
+		upBuf   bytes.Buffer
+		downBuf bytes.Buffer
+		hasUp   bool
+		hasDown bool
+	)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 0, 64*1024), len(b)+1)
+	for s.Scan() {
+		line := s.Text()
+		switch strings.TrimSpace(line) {
+		case upMarker:
+			if hasUp {
+				err = fmt.Errorf("%w, duplicate %q", ErrInvalidMigrationFile, upMarker)
+				return
+			}
+			hasUp = true
+			section = &upBuf
+			continue
+		case downMarker:
+			if hasDown {
+				err = fmt.Errorf("%w, duplicate %q", ErrInvalidMigrationFile, downMarker)
+				return
+			}
+			hasDown = true
+			section = &downBuf
+			continue
+		}
+		if section != nil {
+			section.WriteString(line)
+			section.WriteByte('\n')
+		}
+	}
+	err = s.Err()
+	if err != nil {
+		return
+	}
+	switch {
+	case !hasUp:
+		err = fmt.Errorf("%w, missing %q", ErrInvalidMigrationFile, upMarker)
+	case !hasDown:
+		err = fmt.Errorf("%w, missing %q", ErrInvalidMigrationFile, downMarker)
+	}
+	return upBuf.Bytes(), downBuf.Bytes(), err
+}
+
+// irreversible report if the down migration has the irreversible marker
+func irreversible(src Source, file string) (bool, error) {
+	if _, ok := registeredGo(file); ok {
+		return false, nil
+	}
+	b, err := readMigration(src, file, "down")
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) == irreversibleMarker {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkReversible fails on the first down file marked as irreversible,
+// before any migration is reverted
+func checkReversible(src Source, files []string) error {
+	for _, f := range files {
+		ok, err := irreversible(src, f)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return fmt.Errorf("migration %v %w", f, ErrIrreversible)
+		}
+	}
+	return nil
+}
+
+// requireDown fails with ErrMissingDownFile listing the up files
+// without a down migration, before any of them is executed
+func (m *Migrator) requireDown(files []string) error {
+	down, err := globFiles(m.opts.strategy, m.opts.src, m.source, "down")
+	if err != nil {
+		return err
+	}
+	byVersion, err := fileVersions(m.opts.strategy, down)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, f := range files {
+		v, err := version(m.opts.strategy, f)
+		if err != nil {
+			return err
+		}
+		d, ok := byVersion[v]
+		if ok {
+			ok, err = hasDown(m.opts.src, d)
+			if err != nil {
+				return err
+			}
+		}
+		if !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w for %v", ErrMissingDownFile, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// hasDown report if the down file reverts the migration, a Go migration
+// can have no down function and a single file migration an empty section
+func hasDown(src Source, file string) (bool, error) {
+	if fn, ok := registeredGo(file); ok {
+		return fn != nil, nil
+	}
+	if !isCombined(file) {
+		return true, nil
+	}
+	b, err := readMigration(src, file, "down")
+	return len(bytes.TrimSpace(b)) > 0, err
+}
+
+// readMigration return the SQL of the migration file, for single
+// file migrations only the section of the direction is returned
+func readMigration(src Source, file, direction string) (b []byte, err error) {
+	b, err = readFile(src, file)
+	if err != nil || !isCombined(file) {
+		return
+	}
+	up, down, err := parseCombined(b)
+	if err != nil {
+		err = fmt.Errorf("%v: %w", file, err)
+		return
+	}
+	if direction == "down" {
+		return down, nil
+	}
+	return up, nil
+}
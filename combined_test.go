@@ -0,0 +1,199 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_parseCombined(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		up       string
+		down     string
+		err      error
+	}{
+		{
+			name:     "up and down",
+			contents: "-- +migration Up\nCREATE TABLE a (id int);\n-- +migration Down\nDROP TABLE a;\n",
+			up:       "CREATE TABLE a (id int);\n",
+			down:     "DROP TABLE a;\n",
+		},
+		{
+			name:     "header and empty down",
+			contents: "-- adds table a\n-- +migration Up\nCREATE TABLE a (id int);\n  -- +migration Down  \n",
+			up:       "CREATE TABLE a (id int);\n",
+			down:     "",
+		},
+		{
+			name:     "down first",
+			contents: "-- +migration Down\nDROP TABLE a;\n-- +migration Up\nCREATE TABLE a (id int);",
+			up:       "CREATE TABLE a (id int);\n",
+			down:     "DROP TABLE a;\n",
+		},
+		{
+			name:     "missing up",
+			contents: "CREATE TABLE a (id int);\n-- +migration Down\nDROP TABLE a;\n",
+			err:      ErrInvalidMigrationFile,
+		},
+		{
+			name:     "missing down",
+			contents: "-- +migration Up\nCREATE TABLE a (id int);\n",
+			err:      ErrInvalidMigrationFile,
+		},
+		{
+			name:     "duplicate up",
+			contents: "-- +migration Up\n-- +migration Down\n-- +migration Up\n",
+			err:      ErrInvalidMigrationFile,
+		},
+		{
+			name: "empty file",
+			err:  ErrInvalidMigrationFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, down, err := parseCombined([]byte(tt.contents))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseCombined() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if string(up) != tt.up {
+				t.Errorf("expected up %q but got %q", tt.up, up)
+			}
+			if string(down) != tt.down {
+				t.Errorf("expected down %q but got %q", tt.down, down)
+			}
+		})
+	}
+}
+
+func Test_globFilesCombined(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.sql":      {Data: []byte("-- +migration Up\nCREATE TABLE a (id int);\n-- +migration Down\nDROP TABLE a;\n")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/schema.sql":     {Data: []byte("-- not a migration")},
+	}
+	up, err := upFiles(SequentialStrategy{}, FSSource(fsys), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/001_a.sql", "migrations/002_b.up.sql"}
+	if !reflect.DeepEqual(up, want) {
+		t.Errorf("upFiles() = %v, want %v", up, want)
+	}
+	down, err := downFiles(SequentialStrategy{}, FSSource(fsys), "migrations", []int64{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"migrations/002_b.down.sql", "migrations/001_a.sql"}
+	if !reflect.DeepEqual(down, want) {
+		t.Errorf("downFiles() = %v, want %v", down, want)
+	}
+	fsys["migrations/002_b.sql"] = &fstest.MapFile{Data: []byte("-- +migration Up\n-- +migration Down\n")}
+	_, err = upFiles(SequentialStrategy{}, FSSource(fsys), "migrations")
+	if !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("expected duplicate version error but got %v", err)
+	}
+}
+
+func TestRunCombined(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.sql":      {Data: []byte("-- +migration Up\nCREATE TABLE a (id int);\n-- +migration Down\nDROP TABLE a;\n")},
+		"migrations/002_b.up.sql":   {Data: []byte("INSERT INTO a (id) VALUES (1);")},
+		"migrations/002_b.down.sql": {Data: []byte("DELETE FROM a;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), StrictChecksums())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 migrations executed but got %v", n)
+	}
+	n, _, err = Run(ctx, "migrations", url, "status", WithFS(fsys), StrictChecksums())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected no pending migrations but got %v", n)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "down", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/002_b.down.sql", "migrations/001_a.sql"}
+	if n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v reverted but got %v %v", want, n, executed)
+	}
+}
+
+func TestRunIrreversible(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("ALTER TABLE a ADD COLUMN name text;")},
+		"migrations/002_b.down.sql": {Data: []byte("-- migration:irreversible\n")},
+		"migrations/003_c.sql":      {Data: []byte("-- +migration Up\nCREATE TABLE c (id int);\n-- +migration Down\nDROP TABLE c;\n")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := Run(ctx, "migrations", url, "down", WithFS(fsys))
+	if !errors.Is(err, ErrIrreversible) || !strings.Contains(err.Error(), "002_b.down.sql") {
+		t.Fatalf("expected migration 002 to be irreversible but got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no migration reverted but got %v", n)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "down 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || executed[0] != "migrations/003_c.sql" {
+		t.Errorf("expected the migration after the irreversible one reverted but got %v %v", n, executed)
+	}
+}
+
+func TestRunRequireDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/003_c.sql":      {Data: []byte("-- +migration Up\nCREATE TABLE c (id int);\n-- +migration Down\n")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), RequireDown())
+	if !errors.Is(err, ErrMissingDownFile) || n != 0 {
+		t.Fatalf("expected ErrMissingDownFile before executing but got %v %v", n, err)
+	}
+	for _, f := range []string{"002_b.up.sql", "003_c.sql"} {
+		if !strings.Contains(err.Error(), f) {
+			t.Errorf("expected %v listed in %q", f, err)
+		}
+	}
+	if strings.Contains(err.Error(), "001_a") {
+		t.Errorf("expected 001_a.up.sql not listed in %q", err)
+	}
+	pending, _, err := Run(ctx, "migrations", url, "pending", WithFS(fsys))
+	if err != nil || pending != 3 {
+		t.Errorf("expected the 3 migrations still pending but got %v %v", pending, err)
+	}
+	n, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil || n != 3 {
+		t.Errorf("expected up without RequireDown to execute 3 migrations but got %v %v", n, err)
+	}
+}
@@ -0,0 +1,395 @@
+package migration
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DatabaseConfig holds the driver and the schema_migrations
+// statements for a database engine, the statements are templates
+// where %[1]s is the quoted table name, %[2]s the table name and
+// %[3]s the quoted primary key constraint name and %[4]s the
+// version column type
+type DatabaseConfig struct {
+	// DatabaseType is the engine name, e.g. postgres or cockroach
+	DatabaseType string
+	// DriverName is the database/sql driver used to connect
+	DriverName string
+	// TableName is the table that records the executed migrations
+	TableName string
+	// CheckTableExistsSQL counts the migrations tables
+	CheckTableExistsSQL string
+	// CreateTableSQL creates the migrations table if it doesn't exist
+	CreateTableSQL string
+	// VersionType is the version column type, the default is bigint
+	VersionType string
+	// UpgradeTableSQL adds the columns missing in old migrations tables
+	UpgradeTableSQL []string
+	// InsertSQL records a version with its checksum, applied_at
+	// time and name, it should ignore a version already recorded, e.g. with
+	// ON CONFLICT DO NOTHING, the default is a plain INSERT
+	InsertSQL string
+	// LockSQL and UnlockSQL acquire and release the session
+	// migration lock, no lock is used if LockSQL is empty, %[2]s is
+	// the table name to lock each migrations table apart
+	LockSQL   string
+	UnlockSQL string
+	// LockTable makes the runs claim the row of the %[1]s_lock table
+	// instead of LockSQL, for databases without session locks
+	LockTable bool
+	// ReadOnlySQL returns true when the connection can't write, e.g.
+	// a replica behind a load balancer, the runs fail with ErrReadOnly
+	ReadOnlySQL string
+	// ColumnsSQL lists the table_name, column_name and data_type of
+	// the current schema for the diff, in the columns order
+	ColumnsSQL string
+	// LockTimeoutSQL limits the time a migration waits for
+	// locks, %d is the timeout in milliseconds
+	LockTimeoutSQL string
+	// StatementTimeoutSQL limits the execution time of a migration
+	// with the timeout directive, %d is the timeout in milliseconds,
+	// ResetStatementTimeoutSQL restores it after the migration, the
+	// context deadline is used if StatementTimeoutSQL is empty
+	StatementTimeoutSQL      string
+	ResetStatementTimeoutSQL string
+	// Retries is how many times a migration transaction is executed
+	// again after a serialization failure
+	Retries int
+	// SupportsTransactionalDDL is false for engines where DDL commits
+	// the transaction, a failed migration can be partially applied
+	SupportsTransactionalDDL bool
+	// SplitStatements executes each statement of the migration
+	// files separately, for drivers without multi statement support
+	SplitStatements bool
+	// QuoteIdentifier quotes table and constraint names, the
+	// default uses double quotes
+	QuoteIdentifier func(name string) string
+	// URL translates the database URL to the driver connection string
+	URL func(dbURL string) string
+	// noTable is set by a dry run when the migrations table doesn't
+	// exist, the table is read as empty instead of being created
+	noTable bool
+}
+
+const (
+	defaultTableName    = "schema_migrations"
+	defaultVersionType  = "bigint"
+	pgxDriverName       = "pgx"
+	checkTableExistsSQL = `SELECT count(*) FROM information_schema.tables WHERE table_name = '%[2]s'`
+	columnsSQL          = `SELECT table_name, column_name, data_type FROM information_schema.columns WHERE table_schema = current_schema() ORDER BY table_name, ordinal_position`
+	insertSQL           = `INSERT INTO %[1]s (version, checksum, applied_at, name) VALUES (?, ?, ?, ?)`
+	upsertSQL           = insertSQL + ` ON CONFLICT (version) DO NOTHING`
+)
+
+var (
+	databasesMu sync.RWMutex
+	databases   = map[string]DatabaseConfig{}
+
+	identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	postgresConfig = DatabaseConfig{
+		DatabaseType:        "postgres",
+		DriverName:          "postgres",
+		TableName:           defaultTableName,
+		CheckTableExistsSQL: checkTableExistsSQL,
+		CreateTableSQL:      `CREATE TABLE IF NOT EXISTS %[1]s (version %[4]s NOT NULL, checksum text, applied_at timestamp with time zone, name text NOT NULL DEFAULT '', CONSTRAINT %[3]s PRIMARY KEY (version))`,
+		UpgradeTableSQL: []string{
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS checksum text`,
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS applied_at timestamp with time zone`,
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS name text NOT NULL DEFAULT ''`,
+		},
+		InsertSQL:                upsertSQL,
+		SupportsTransactionalDDL: true,
+		LockSQL:                  fmt.Sprintf(`SELECT pg_advisory_lock(%d)`, advisoryLockID),
+		UnlockSQL:                fmt.Sprintf(`SELECT pg_advisory_unlock(%d)`, advisoryLockID),
+		ReadOnlySQL:              `SELECT pg_is_in_recovery() OR current_setting('transaction_read_only') = 'on'`,
+		ColumnsSQL:               columnsSQL,
+		LockTimeoutSQL:           `SET LOCAL lock_timeout = '%dms'`,
+		StatementTimeoutSQL:      `SET LOCAL statement_timeout = '%dms'`,
+		ResetStatementTimeoutSQL: `SET LOCAL statement_timeout TO DEFAULT`,
+	}
+	// cockroachConfig uses the postgres driver, CockroachDB has no
+	// advisory locks, asks clients to retry serialization failures and
+	// its schema changes are not atomic with the transaction
+	cockroachConfig = DatabaseConfig{
+		DatabaseType:        "cockroach",
+		DriverName:          "postgres",
+		TableName:           defaultTableName,
+		CheckTableExistsSQL: checkTableExistsSQL,
+		VersionType:         "INT8",
+		CreateTableSQL:      `CREATE TABLE IF NOT EXISTS %[1]s (version %[4]s NOT NULL, checksum STRING, applied_at TIMESTAMPTZ, name STRING NOT NULL DEFAULT '', CONSTRAINT %[3]s PRIMARY KEY (version))`,
+		UpgradeTableSQL: []string{
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS checksum STRING`,
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS applied_at TIMESTAMPTZ`,
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS name STRING NOT NULL DEFAULT ''`,
+		},
+		InsertSQL:                upsertSQL,
+		ColumnsSQL:               columnsSQL,
+		LockTimeoutSQL:           `SET LOCAL lock_timeout = '%dms'`,
+		StatementTimeoutSQL:      `SET LOCAL statement_timeout = '%dms'`,
+		ResetStatementTimeoutSQL: `SET LOCAL statement_timeout TO DEFAULT`,
+		Retries:                  3,
+		URL: func(dbURL string) string {
+			u, err := url.Parse(dbURL)
+			if err != nil {
+				return dbURL
+			}
+			u.Scheme = "postgres"
+			return u.String()
+		},
+	}
+	// sqliteConfig uses the modernc.org/sqlite driver, the database
+	// file is locked by SQLite itself
+	sqliteConfig = DatabaseConfig{
+		DatabaseType:        "sqlite",
+		DriverName:          "sqlite",
+		TableName:           defaultTableName,
+		CheckTableExistsSQL: `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = '%[2]s'`,
+		CreateTableSQL:      `CREATE TABLE IF NOT EXISTS %[1]s (version %[4]s NOT NULL, checksum text, applied_at timestamp, name text NOT NULL DEFAULT '', CONSTRAINT %[3]s PRIMARY KEY (version))`,
+		// SQLite has no ADD COLUMN IF NOT EXISTS, the duplicate
+		// column error of the upgraded tables is ignored
+		UpgradeTableSQL: []string{
+			`ALTER TABLE %[1]s ADD COLUMN name text NOT NULL DEFAULT ''`,
+		},
+		SupportsTransactionalDDL: true,
+		InsertSQL:                `INSERT OR IGNORE INTO %[1]s (version, checksum, applied_at, name) VALUES (?, ?, ?, ?)`,
+		LockTimeoutSQL:           `PRAGMA busy_timeout = %d`,
+		ReadOnlySQL:              `PRAGMA query_only`,
+		ColumnsSQL:               `SELECT m.name AS table_name, p.name AS column_name, p.type AS data_type FROM sqlite_master m JOIN pragma_table_info(m.name) p WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' ORDER BY m.name, p.cid`,
+		LockTable:                true,
+		URL:                      sqliteConnString,
+	}
+	sqlserverConfig = DatabaseConfig{
+		DatabaseType:        "sqlserver",
+		DriverName:          "sqlserver",
+		TableName:           defaultTableName,
+		CheckTableExistsSQL: checkTableExistsSQL,
+		CreateTableSQL: `IF NOT EXISTS (SELECT 1 FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = '%[2]s')
+CREATE TABLE %[1]s (version %[4]s NOT NULL, checksum nvarchar(64), applied_at datetime2, name nvarchar(255) NOT NULL DEFAULT '', CONSTRAINT %[3]s PRIMARY KEY (version))`,
+		UpgradeTableSQL: []string{
+			`IF COL_LENGTH('%[2]s', 'checksum') IS NULL ALTER TABLE %[1]s ADD checksum nvarchar(64)`,
+			`IF COL_LENGTH('%[2]s', 'applied_at') IS NULL ALTER TABLE %[1]s ADD applied_at datetime2`,
+			`IF COL_LENGTH('%[2]s', 'name') IS NULL ALTER TABLE %[1]s ADD name nvarchar(255) NOT NULL DEFAULT ''`,
+		},
+		SupportsTransactionalDDL: true,
+		InsertSQL:                `IF NOT EXISTS (SELECT 1 FROM %[1]s WHERE version = @p1) INSERT INTO %[1]s (version, checksum, applied_at, name) VALUES (@p1, @p2, @p3, @p4)`,
+		LockSQL:                  `EXEC sp_getapplock @Resource = '%[2]s', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = -1`,
+		UnlockSQL:                `EXEC sp_releaseapplock @Resource = '%[2]s', @LockOwner = 'Session'`,
+		ReadOnlySQL:              `SELECT CASE WHEN DATABASEPROPERTYEX(DB_NAME(), 'Updateability') = 'READ_ONLY' THEN 1 ELSE 0 END`,
+		LockTimeoutSQL:           `SET LOCK_TIMEOUT %d`,
+		QuoteIdentifier: func(name string) string {
+			return "[" + name + "]"
+		},
+		URL: func(dbURL string) string {
+			if strings.HasPrefix(dbURL, "mssql://") {
+				return "sqlserver" + strings.TrimPrefix(dbURL, "mssql")
+			}
+			return dbURL
+		},
+	}
+)
+
+// GetDatabaseConfig return the DatabaseConfig for the database URL scheme,
+// URLs without scheme are PostgreSQL connection strings
+func GetDatabaseConfig(dbURL string) (*DatabaseConfig, error) {
+	if strings.HasPrefix(dbURL, "sqlite:") {
+		cfg := sqliteConfig
+		return &cfg, nil
+	}
+	if !strings.Contains(dbURL, "://") {
+		cfg := postgresConfig
+		return &cfg, nil
+	}
+	u, err := url.Parse(socketURL(dbURL))
+	if err != nil {
+		return nil, maskErr(err)
+	}
+	databasesMu.RLock()
+	cfg, ok := databases[u.Scheme]
+	databasesMu.RUnlock()
+	if ok {
+		return &cfg, nil
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		cfg = postgresConfig
+		pgxDriver(&cfg, u)
+	case "cockroach", "cockroachdb":
+		cfg = cockroachConfig
+		pgxDriver(&cfg, u)
+	case "sqlserver", "mssql":
+		cfg = sqlserverConfig
+	default:
+		return nil, fmt.Errorf("%w %q, use postgres, cockroach, sqlite, sqlserver or a registered scheme", ErrUnsupportedScheme, u.Scheme)
+	}
+	return &cfg, nil
+}
+
+// pgxDriver makes cfg use the jackc/pgx stdlib driver when the URL has
+// driver=pgx, the parameter is removed from the connection string
+func pgxDriver(cfg *DatabaseConfig, u *url.URL) {
+	if u.Query().Get("driver") != pgxDriverName {
+		return
+	}
+	cfg.DriverName = pgxDriverName
+	transform := cfg.URL
+	cfg.URL = func(dbURL string) string {
+		if transform != nil {
+			dbURL = transform(dbURL)
+		}
+		u, err := url.Parse(dbURL)
+		if err != nil {
+			return dbURL
+		}
+		q := u.Query()
+		q.Del("driver")
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+}
+
+// RegisterDatabase makes GetDatabaseConfig return cfg for the URL
+// scheme, urlTransform translates the URL to the driver connection
+// string, if it is nil the URL is passed to the driver as is
+func RegisterDatabase(scheme string, cfg DatabaseConfig, urlTransform func(string) string) {
+	if cfg.TableName == "" {
+		cfg.TableName = defaultTableName
+	}
+	if cfg.CheckTableExistsSQL == "" {
+		cfg.CheckTableExistsSQL = checkTableExistsSQL
+	}
+	cfg.URL = urlTransform
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	databases[scheme] = cfg
+}
+
+// unregisterDatabase remove a scheme added with RegisterDatabase
+func unregisterDatabase(scheme string) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	delete(databases, scheme)
+}
+
+// ConfigForDriver return the DatabaseConfig for a database/sql driver
+// name, e.g. the DriverName of a *sqlx.DB, to use RunWithExistingDatabase
+// without a URL, CockroachDB uses the PostgreSQL drivers so its config
+// comes from GetDatabaseConfig with a cockroach URL
+func ConfigForDriver(driverName string) (*DatabaseConfig, error) {
+	cfg, ok := lookupDriver(driverName)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedDriver, driverName)
+	}
+	return &cfg, nil
+}
+
+// driverConfig return the DatabaseConfig for an open connection,
+// registered databases are matched by the driver name first, the
+// unknown drivers get the PostgreSQL config
+func driverConfig(driverName string) *DatabaseConfig {
+	cfg, ok := lookupDriver(driverName)
+	if !ok {
+		cfg = postgresConfig
+	}
+	return &cfg
+}
+
+// lookupDriver return the registered database with the driver name,
+// the first by scheme, else the built-in database of the driver
+func lookupDriver(driverName string) (cfg DatabaseConfig, ok bool) {
+	databasesMu.RLock()
+	schemes := make([]string, 0, len(databases))
+	for scheme, c := range databases {
+		if c.DriverName == driverName {
+			schemes = append(schemes, scheme)
+		}
+	}
+	sort.Strings(schemes)
+	if len(schemes) > 0 {
+		cfg = databases[schemes[0]]
+	}
+	databasesMu.RUnlock()
+	if len(schemes) > 0 {
+		return cfg, true
+	}
+	switch driverName {
+	case postgresConfig.DriverName:
+		cfg = postgresConfig
+	case pgxDriverName:
+		cfg = postgresConfig
+		cfg.DriverName = pgxDriverName
+	case sqlserverConfig.DriverName:
+		cfg = sqlserverConfig
+	case sqliteConfig.DriverName:
+		cfg = sqliteConfig
+	default:
+		return cfg, false
+	}
+	return cfg, true
+}
+
+// sqliteBusyTimeout makes the connections wait for the locks of the
+// other processes instead of failing with SQLITE_BUSY
+const sqliteBusyTimeout = "_pragma=busy_timeout(5000)"
+
+// sqliteConnString translates sqlite:///path/app.db?cache=shared and
+// sqlite::memory:?cache=shared to SQLite URI file names keeping the
+// query parameters, a busy_timeout is added if the URL has none
+func sqliteConnString(dbURL string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return dbURL
+	}
+	name := u.Opaque
+	if name == "" {
+		name = u.Host + u.Path
+	}
+	query := u.RawQuery
+	if !strings.Contains(query, "busy_timeout(") {
+		query = strings.TrimPrefix(query+"&"+sqliteBusyTimeout, "&")
+	}
+	return "file:" + name + "?" + query
+}
+
+// isMemory report if the SQLite URL is an in-memory database
+func isMemory(dbURL string) bool {
+	return strings.Contains(dbURL, ":memory:") || strings.Contains(dbURL, "mode=memory")
+}
+
+// postgres report if the database uses a PostgreSQL driver
+func (c *DatabaseConfig) postgres() bool {
+	return c.DriverName == postgresConfig.DriverName || c.DriverName == pgxDriverName
+}
+
+// connString return the driver connection string for dbURL
+func (c *DatabaseConfig) connString(dbURL string) string {
+	if c.URL == nil {
+		return dbURL
+	}
+	return c.URL(dbURL)
+}
+
+func (c *DatabaseConfig) quote(name string) string {
+	if c.QuoteIdentifier == nil {
+		return `"` + name + `"`
+	}
+	return c.QuoteIdentifier(name)
+}
+
+// query fills the table name in the statement template
+func (c *DatabaseConfig) query(tmpl string) string {
+	versionType := c.VersionType
+	if versionType == "" {
+		versionType = defaultVersionType
+	}
+	return fmt.Sprintf(tmpl, c.quote(c.TableName), c.TableName, c.quote(c.TableName+"_pkey"), versionType)
+}
+
+// validIdentifier reports whether name can be used as a table name
+func validIdentifier(name string) bool {
+	return identifierRegexp.MatchString(name)
+}
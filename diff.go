@@ -0,0 +1,300 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Snapshot is the tables of a database or of a schema file in order
+type Snapshot struct {
+	Tables []Table `json:"tables"`
+}
+
+// Table is a table with its columns in order, SQL is the
+// CREATE TABLE statement of a schema file
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	SQL     string   `json:"sql,omitempty"`
+}
+
+// Column is a table column, Definition is its type and
+// constraints, e.g. text NOT NULL
+type Column struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+var createTableRegexp = regexp.MustCompile(`(?is)^CREATE\s+(?:(?:GLOBAL\s+|LOCAL\s+)?TEMP(?:ORARY)?\s+|UNLOGGED\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?((?:"[^"]+"|[\w$]+)(?:\.(?:"[^"]+"|[\w$]+))?)\s*\(`)
+
+// tableConstraints are the first words of the CREATE TABLE
+// elements that are not columns
+var tableConstraints = map[string]bool{
+	"CONSTRAINT": true,
+	"PRIMARY":    true,
+	"UNIQUE":     true,
+	"FOREIGN":    true,
+	"CHECK":      true,
+	"EXCLUDE":    true,
+	"LIKE":       true,
+}
+
+// ParseSnapshot read the tables of the CREATE TABLE statements of a
+// schema file, e.g. a pg_dump --schema-only, the other statements
+// are ignored
+func ParseSnapshot(r io.Reader) (s *Snapshot, err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	s = &Snapshot{}
+	for _, stmt := range splitStatements(string(b)) {
+		stmt = strings.TrimSpace(stripComments(stmt))
+		m := createTableRegexp.FindStringSubmatchIndex(stmt)
+		if m == nil {
+			continue
+		}
+		name := stmt[m[2]:m[3]]
+		end := closingParen(stmt, m[1]-1)
+		if end < 0 {
+			err = fmt.Errorf("table %v: unbalanced parentheses", name)
+			return
+		}
+		t := Table{Name: name, SQL: stmt}
+		for _, e := range splitList(stmt[m[1]:end]) {
+			col, def := splitIdentifier(e)
+			if col == "" || tableConstraints[strings.ToUpper(col)] {
+				continue
+			}
+			t.Columns = append(t.Columns, Column{Name: col, Definition: def})
+		}
+		if s.table(name) == nil {
+			s.Tables = append(s.Tables, t)
+		}
+	}
+	return
+}
+
+// ReadSnapshot return the tables of the database of url without
+// the migrations table
+func ReadSnapshot(ctx context.Context, url string, opts ...Option) (s *Snapshot, err error) {
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		return
+	}
+	m, err := configure(cfg, opts)
+	if err != nil {
+		return
+	}
+	err = m.open(ctx, url)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	s, err = m.snapshot(ctx)
+	return
+}
+
+// snapshot read the columns of the current schema with ColumnsSQL
+func (m *Migrator) snapshot(ctx context.Context) (s *Snapshot, err error) {
+	if m.cfg.ColumnsSQL == "" {
+		err = fmt.Errorf("reading the schema of %v is not supported", m.cfg.DatabaseType)
+		return
+	}
+	var rows []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+		Type   string `db:"data_type"`
+	}
+	err = sqlx.SelectContext(ctx, m.conn(), &rows, m.cfg.ColumnsSQL)
+	if err != nil {
+		return
+	}
+	s = &Snapshot{}
+	for _, r := range rows {
+		if r.Table == m.cfg.TableName || r.Table == lockTableConfig(m.cfg).TableName {
+			continue
+		}
+		t := s.table(r.Table)
+		if t == nil {
+			s.Tables = append(s.Tables, Table{Name: r.Table})
+			t = &s.Tables[len(s.Tables)-1]
+		}
+		t.Columns = append(t.Columns, Column{Name: r.Column, Definition: r.Type})
+	}
+	return
+}
+
+// Diff return the statements that add the tables and the columns of
+// target missing in current, the tables and columns missing in target
+// are returned as comments to review, nothing is dropped
+func Diff(current, target *Snapshot) (statements []string) {
+	for _, t := range target.Tables {
+		c := current.table(t.Name)
+		if c == nil {
+			statements = append(statements, t.create()+";")
+			continue
+		}
+		for _, col := range t.Columns {
+			if c.column(col.Name) == nil {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v %v;", t.Name, col.Name, col.Definition))
+			}
+		}
+	}
+	for _, c := range current.Tables {
+		t := target.table(c.Name)
+		if t == nil {
+			statements = append(statements, fmt.Sprintf("-- table %v is not in the target schema", c.Name))
+			continue
+		}
+		for _, col := range c.Columns {
+			if t.column(col.Name) == nil {
+				statements = append(statements, fmt.Sprintf("-- column %v.%v is not in the target schema", c.Name, col.Name))
+			}
+		}
+	}
+	return
+}
+
+// create return the CREATE TABLE statement of t
+func (t *Table) create() string {
+	if t.SQL != "" {
+		return t.SQL
+	}
+	cols := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		cols = append(cols, "    "+c.Name+" "+c.Definition)
+	}
+	return fmt.Sprintf("CREATE TABLE %v (\n%v\n)", t.Name, strings.Join(cols, ",\n"))
+}
+
+// table return the table named name, nil if there is none
+func (s *Snapshot) table(name string) *Table {
+	key := identifierKey(name)
+	for i := range s.Tables {
+		if identifierKey(s.Tables[i].Name) == key {
+			return &s.Tables[i]
+		}
+	}
+	return nil
+}
+
+// column return the column named name, nil if there is none
+func (t *Table) column(name string) *Column {
+	key := identifierKey(name)
+	for i := range t.Columns {
+		if identifierKey(t.Columns[i].Name) == key {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// identifierKey compares identifiers without the schema, the
+// quotes and the case
+func identifierKey(name string) string {
+	if strings.HasSuffix(name, `"`) {
+		name = name[strings.LastIndex(name[:len(name)-1], `"`):]
+	} else if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(strings.Trim(name, `"`))
+}
+
+// stripComments removes the -- and /* */ comments out of the quotes
+func stripComments(sql string) string {
+	var b strings.Builder
+	for i := 0; i < len(sql); {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			j := skipQuoted(sql, i, c)
+			b.WriteString(sql[i:j])
+			i = j
+		case strings.HasPrefix(sql[i:], "--"):
+			n := strings.IndexByte(sql[i:], '\n')
+			if n < 0 {
+				return b.String()
+			}
+			i += n
+		case strings.HasPrefix(sql[i:], "/*"):
+			n := strings.Index(sql[i+2:], "*/")
+			if n < 0 {
+				return b.String()
+			}
+			i += n + 4
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// closingParen return the position of the parenthesis closing the
+// one at open, -1 when it is not closed
+func closingParen(sql string, open int) int {
+	depth := 0
+	for i := open; i < len(sql); {
+		switch c := sql[i]; c {
+		case '\'', '"':
+			i = skipQuoted(sql, i, c)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// splitList split the CREATE TABLE elements on the commas out of
+// parentheses and quotes
+func splitList(sql string) (items []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(sql); {
+		switch c := sql[i]; c {
+		case '\'', '"':
+			i = skipQuoted(sql, i, c)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(sql[start:i]))
+				start = i + 1
+			}
+		}
+		i++
+	}
+	if s := strings.TrimSpace(sql[start:]); s != "" {
+		items = append(items, s)
+	}
+	return
+}
+
+// splitIdentifier split the first identifier, quoted or not,
+// of the element from the rest of its definition
+func splitIdentifier(e string) (name, rest string) {
+	if strings.HasPrefix(e, `"`) {
+		end := skipQuoted(e, 0, '"')
+		return e[:end], strings.TrimSpace(e[end:])
+	}
+	i := strings.IndexFunc(e, unicode.IsSpace)
+	if i < 0 {
+		return e, ""
+	}
+	return e[:i], strings.TrimSpace(e[i:])
+}
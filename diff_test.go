@@ -0,0 +1,129 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestParseSnapshot(t *testing.T) {
+	sql := `-- schema
+CREATE TABLE IF NOT EXISTS public.users (
+    id serial PRIMARY KEY,
+    "Full Name" text NOT NULL, -- shown name
+    balance numeric(10,2) DEFAULT 0 CHECK (balance >= 0),
+    note text DEFAULT 'a, b',
+    CONSTRAINT users_name UNIQUE ("Full Name"),
+    CHECK (id > 0)
+);
+/* CREATE TABLE ignored (id int); */
+CREATE INDEX users_note ON users (note);
+create table orders (id int, user_id int REFERENCES users (id), FOREIGN KEY (id) REFERENCES users (id));
+`
+	s, err := ParseSnapshot(strings.NewReader(sql))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Table{
+		{Name: "public.users", Columns: []Column{
+			{Name: "id", Definition: "serial PRIMARY KEY"},
+			{Name: `"Full Name"`, Definition: "text NOT NULL"},
+			{Name: "balance", Definition: "numeric(10,2) DEFAULT 0 CHECK (balance >= 0)"},
+			{Name: "note", Definition: "text DEFAULT 'a, b'"},
+		}},
+		{Name: "orders", Columns: []Column{
+			{Name: "id", Definition: "int"},
+			{Name: "user_id", Definition: "int REFERENCES users (id)"},
+		}},
+	}
+	for i := range s.Tables {
+		s.Tables[i].SQL = ""
+	}
+	if !reflect.DeepEqual(s.Tables, want) {
+		t.Errorf("expected %+v but got %+v", want, s.Tables)
+	}
+
+	_, err = ParseSnapshot(strings.NewReader("CREATE TABLE a (id int"))
+	if err == nil {
+		t.Error("expected an error for the unbalanced parentheses")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	current := &Snapshot{Tables: []Table{
+		{Name: "users", Columns: []Column{{Name: "id", Definition: "integer"}, {Name: "legacy", Definition: "text"}}},
+		{Name: "old", Columns: []Column{{Name: "id", Definition: "integer"}}},
+	}}
+	target, err := ParseSnapshot(strings.NewReader(`
+CREATE TABLE public."USERS" (id integer, email text NOT NULL DEFAULT '');
+CREATE TABLE orders (id integer PRIMARY KEY);
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Diff(current, target)
+	want := []string{
+		`ALTER TABLE public."USERS" ADD COLUMN email text NOT NULL DEFAULT '';`,
+		"CREATE TABLE orders (id integer PRIMARY KEY);",
+		"-- column users.legacy is not in the target schema",
+		"-- table old is not in the target schema",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+	if got := Diff(target, target); len(got) != 0 {
+		t.Errorf("expected no statements between equal schemas but got %q", got)
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	fsys := fstest.MapFS{
+		"migrations/001_users.up.sql": {Data: []byte("CREATE TABLE users (id integer PRIMARY KEY, name text NOT NULL);")},
+	}
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE orders (id integer, total numeric(10,2))")
+	db.Close() // nolint
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ReadSnapshot(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Table{
+		{Name: "orders", Columns: []Column{{Name: "id", Definition: "INTEGER"}, {Name: "total", Definition: "numeric(10,2)"}}},
+		{Name: "users", Columns: []Column{{Name: "id", Definition: "INTEGER"}, {Name: "name", Definition: "TEXT"}}},
+	}
+	if !reflect.DeepEqual(s.Tables, want) {
+		t.Errorf("expected %+v without the migrations table but got %+v", want, s.Tables)
+	}
+
+	target, err := ParseSnapshot(strings.NewReader("CREATE TABLE users (id integer PRIMARY KEY, name text NOT NULL, email text);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Diff(s, target)
+	want2 := []string{
+		"ALTER TABLE users ADD COLUMN email text;",
+		"-- table orders is not in the target schema",
+	}
+	if !reflect.DeepEqual(got, want2) {
+		t.Errorf("expected %q but got %q", want2, got)
+	}
+}
@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// directivePrefix starts the directives in the leading comment lines
+// of a migration file, e.g. -- migration:timeout=30s
+const directivePrefix = "-- migration:"
+
+// directives are the options of a single migration file
+type directives struct {
+	// timeout limits the execution time of the migration statements
+	timeout time.Duration
+}
+
+// parseDirectives read the directives of the leading comment lines,
+// it stops at the first line that is not a comment or blank, unknown
+// directives are ignored
+func parseDirectives(b []byte) (d directives, err error) {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 0, 64*1024), len(b)+1)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		if !strings.HasPrefix(line, directivePrefix) {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, directivePrefix), "=")
+		switch strings.TrimSpace(key) {
+		case "timeout":
+			d.timeout, err = time.ParseDuration(strings.TrimSpace(value))
+			if err == nil && d.timeout <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+			if err != nil {
+				return directives{}, fmt.Errorf("invalid %q directive: %w", line, err)
+			}
+		}
+	}
+	err = s.Err()
+	return
+}
@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_parseDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "timeout", sql: "-- migration:timeout=30s\nCREATE TABLE a (id int);", want: 30 * time.Second},
+		{name: "after comments", sql: "-- users table\n\n-- migration:timeout = 2m\nCREATE TABLE a (id int);", want: 2 * time.Minute},
+		{name: "after SQL", sql: "CREATE TABLE a (id int);\n-- migration:timeout=30s\n"},
+		{name: "unknown", sql: "-- migration:other\nCREATE TABLE a (id int);"},
+		{name: "invalid", sql: "-- migration:timeout=soon\n", wantErr: true},
+		{name: "negative", sql: "-- migration:timeout=-1s\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDirectives([]byte(tt.sql))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDirectives() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.timeout != tt.want {
+				t.Errorf("parseDirectives() timeout = %v, want %v", got.timeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTimeoutDirective(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql": {Data: []byte(`-- migration:timeout=50ms
+CREATE TABLE b AS WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT x FROM c LIMIT 1000000000;`)},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	start := time.Now()
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), PerMigrationTx())
+	if !errors.Is(err, ErrMigrationFailed) {
+		t.Fatalf("expected the slow migration to abort but got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("expected the migration to abort after the timeout but it took %v", d)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 migration executed but got %v", n)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("expected only the first version recorded but got %v", versions)
+	}
+}
@@ -0,0 +1,94 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Check is the result of one of the Doctor checks, Err is nil when it passed
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Doctor checks the database URL, the driver, the connection and the
+// migrations source without changing the database, the database checks
+// stop at the first failure
+func Doctor(ctx context.Context, source, dbURL string, opts ...Option) (checks []Check) {
+	add := func(name string, err error) bool {
+		checks = append(checks, Check{Name: name, Err: err})
+		return err == nil
+	}
+	databaseChecks(ctx, dbURL, add)
+	o := newOptions(opts)
+	if !add("migrations directory", checkSource(o.strategy, o.src, source)) {
+		return
+	}
+	add("up and down pairs", checkPairs(o.strategy, o.src, source))
+	return
+}
+
+func databaseChecks(ctx context.Context, dbURL string, add func(name string, err error) bool) {
+	dbURL = socketURL(dbURL)
+	var err error
+	if strings.Contains(dbURL, "://") {
+		_, err = url.Parse(dbURL)
+		err = maskErr(err)
+	}
+	if !add("database url", err) {
+		return
+	}
+	cfg, err := GetDatabaseConfig(dbURL)
+	if !add("database scheme", err) {
+		return
+	}
+	if !slices.Contains(sql.Drivers(), cfg.DriverName) {
+		err = fmt.Errorf("driver %q is not compiled in", cfg.DriverName)
+	}
+	if !add("database driver", err) {
+		return
+	}
+	db, err := open(ctx, dbURL, cfg)
+	if err == nil {
+		db.Close() // nolint
+	}
+	add("database connection", err)
+}
+
+// checkPairs check that every up migration has a down migration
+// and every down migration has an up migration
+func checkPairs(vs VersionStrategy, src Source, source string) error {
+	up, err := globFiles(vs, src, source, "up")
+	if err != nil {
+		return err
+	}
+	down, err := globFiles(vs, src, source, "down")
+	if err != nil {
+		return err
+	}
+	versions := map[int64]int{}
+	for _, files := range [][]string{up, down} {
+		for _, f := range files {
+			v, err := version(vs, f)
+			if err != nil {
+				return err
+			}
+			versions[v]++
+		}
+	}
+	var missing []string
+	for _, f := range append(up, down...) {
+		v, _ := version(vs, f)
+		if versions[v] == 1 {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no matching up or down migration for %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDoctor(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.sql":      {Data: []byte("-- +migration Up\nCREATE TABLE b (id int);\n-- +migration Down\nDROP TABLE b;\n")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	checks := Doctor(ctx, "migrations", url, WithFS(fsys))
+	if len(checks) != 6 {
+		t.Errorf("expected 6 checks but got %v", checks)
+	}
+	for _, c := range checks {
+		if c.Err != nil {
+			t.Errorf("expected %v to pass but got %v", c.Name, c.Err)
+		}
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err == nil && len(versions) != 0 {
+		t.Errorf("expected doctor to not change the database but got %v", versions)
+	}
+
+	fsys["migrations/003_c.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id int);")}
+	checks = Doctor(ctx, "migrations", "unknown://localhost", WithFS(fsys))
+	want := []string{"database url", "database scheme", "migrations directory", "up and down pairs"}
+	if len(checks) != len(want) {
+		t.Fatalf("expected the checks %v but got %v", want, checks)
+	}
+	for i, c := range checks {
+		if c.Name != want[i] {
+			t.Errorf("expected the check %v but got %v", want[i], c.Name)
+		}
+		if failed := c.Err != nil; failed != (i == 1 || i == 3) {
+			t.Errorf("unexpected result of %v: %v", c.Name, c.Err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	urlPasswordRegexp = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.-]*://[^:/@\s"]*:)([^@\s"]*)@`)
+	kvPasswordRegexp  = regexp.MustCompile(`(password\s*=\s*)('(?:\\.|[^'])*'|[^\s&]+)`)
+	socketPortRegexp  = regexp.MustCompile(`^(.*):([0-9]+)$`)
+)
+
+// socketURL moves the Unix socket directory escaped in the host of a
+// PostgreSQL URL, postgres://%2Fvar%2Frun%2Fpostgresql/dbname, to the
+// host parameter, url.Parse and the drivers reject the escaped slashes,
+// postgres:///dbname?host=/var/run/postgresql is already understood
+func socketURL(dbURL string) string {
+	scheme, rest, ok := strings.Cut(dbURL, "://")
+	if !ok || (scheme != "postgres" && scheme != "postgresql") {
+		return dbURL
+	}
+	end := strings.IndexAny(rest, "/?")
+	if end < 0 {
+		end = len(rest)
+	}
+	authority, tail := rest[:end], rest[end:]
+	userinfo, host := "", authority
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userinfo, host = authority[:i+1], authority[i+1:]
+	}
+	if !strings.HasPrefix(strings.ToLower(host), "%2f") {
+		return dbURL
+	}
+	dir, err := url.PathUnescape(host)
+	if err != nil {
+		return dbURL
+	}
+	params := url.Values{}
+	if m := socketPortRegexp.FindStringSubmatch(dir); m != nil {
+		dir = m[1]
+		params.Set("port", m[2])
+	}
+	params.Set("host", dir)
+	sep := "?"
+	if strings.Contains(tail, "?") {
+		sep = "&"
+	}
+	return scheme + "://" + userinfo + tail + sep + params.Encode()
+}
+
+// maskDSN replaces the password of the database URLs or key=value
+// connection strings in the text with ****
+func maskDSN(dbURL string) string {
+	dbURL = urlPasswordRegexp.ReplaceAllString(dbURL, "${1}****@")
+	return kvPasswordRegexp.ReplaceAllString(dbURL, "${1}****")
+}
+
+// maskedError hides the passwords of the database URLs in the
+// message of the wrapped error
+type maskedError struct {
+	err error
+}
+
+// maskErr return err with the password of the database URLs masked
+// in its message by maskDSN, the rest of the message is unchanged
+func maskErr(err error) error {
+	if err == nil || maskDSN(err.Error()) == err.Error() {
+		return err
+	}
+	return &maskedError{err: err}
+}
+
+func (e *maskedError) Error() string {
+	return maskDSN(e.err.Error())
+}
+
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
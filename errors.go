@@ -0,0 +1,133 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrEmptyAction is returned when no migration action is given
+	ErrEmptyAction = errors.New("the migration action is required")
+	// ErrUnknownAction is returned for an unsupported migration action
+	ErrUnknownAction = errors.New("unknown migration command")
+	// ErrInvalidParameters is returned when the action has too many parameters
+	ErrInvalidParameters = errors.New("the number of migration parameters is incorrect")
+	// ErrInvalidSyntax is returned when the action parameter is not a number
+	ErrInvalidSyntax = errors.New("invalid syntax")
+	// ErrMissingVersion is returned when the action requires a version parameter
+	ErrMissingVersion = errors.New("requires the target version")
+	// ErrNoDirectory is returned when the migrations directory is empty
+	ErrNoDirectory = errors.New("the migrations directory is required")
+	// ErrNotDirectory is returned when the migrations source is not a directory
+	ErrNotDirectory = errors.New("not a directory")
+	// ErrNoMigrationFiles is returned when the migrations directories have no migration files
+	ErrNoMigrationFiles = errors.New("no migration files")
+	// ErrInvalidVersion is returned when a file name has no numeric version prefix
+	ErrInvalidVersion = errors.New("invalid migration version")
+	// ErrInvalidMigrationFile is returned when a single file migration
+	// doesn't have exactly one up and one down section
+	ErrInvalidMigrationFile = errors.New("invalid migration file")
+	// ErrDuplicateVersion is returned when two files have the same version
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	// ErrMissingDownFile is returned when an executed migration has no down file
+	ErrMissingDownFile = errors.New("missing down migration")
+	// ErrIrreversible is returned when down would revert a migration
+	// marked as irreversible
+	ErrIrreversible = errors.New("is irreversible")
+	// ErrMissingUpFile is returned when an executed migration has no up file
+	ErrMissingUpFile = errors.New("missing up migration")
+	// ErrVersionNotFound is returned when no migration file has the requested version
+	ErrVersionNotFound = errors.New("migration version not found")
+	// ErrOutOfOrder is returned when a migration would be executed
+	// before pending migrations with lower versions
+	ErrOutOfOrder = errors.New("lower versions are still pending")
+	// ErrBaselineNotEmpty is returned by baseline when the migrations
+	// table already has rows
+	ErrBaselineNotEmpty = errors.New("the migrations table is not empty")
+	// ErrChecksumMismatch is returned when an executed migration file was changed
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrDrift is returned by verify when executed migrations were
+	// changed or their files removed
+	ErrDrift = errors.New("executed migrations were changed or removed")
+	// ErrUnsupportedScheme is returned when the database URL scheme has no DatabaseConfig
+	ErrUnsupportedScheme = errors.New("unsupported database scheme")
+	// ErrUnsupportedDriver is returned by ConfigForDriver for a driver without DatabaseConfig
+	ErrUnsupportedDriver = errors.New("unsupported database driver")
+	// ErrInvalidTableName is returned when the table name is not a valid SQL identifier
+	ErrInvalidTableName = errors.New("invalid table name")
+	// ErrInvalidSchemaName is returned when the schema name is not a valid SQL identifier
+	ErrInvalidSchemaName = errors.New("invalid schema name")
+	// ErrIncompatibleTable is returned when the migrations table exists
+	// without the expected columns, e.g. created by another tool
+	ErrIncompatibleTable = errors.New("incompatible migrations table")
+	// ErrNoTransactionalDDL is returned by plan when the database
+	// commits DDL statements and they can't be rolled back
+	ErrNoTransactionalDDL = errors.New("database without transactional DDL")
+	// ErrOpenDatabase is returned when the database connection fails
+	ErrOpenDatabase = errors.New("unable to open db")
+	// ErrPingDatabase is returned when the database doesn't answer the ping
+	ErrPingDatabase = errors.New("error ping db")
+	// ErrReadOnly is returned when the database URL connects to a
+	// read-only node, e.g. a replica
+	ErrReadOnly = errors.New("database is read-only, connect to the primary")
+	// ErrLock is returned when the migration lock can't be acquired
+	ErrLock = errors.New("unable to acquire the migration lock")
+	// ErrDestructiveAction is returned when down, force or goto to a lower
+	// version is used with ProtectDestructive and without confirmation
+	ErrDestructiveAction = errors.New("requires confirmation")
+	// errAlreadyApplied is returned by insertMigrations when the
+	// version was recorded by a concurrent run
+	errAlreadyApplied = errors.New("migration already applied")
+	// ErrMigrationFailed is matched by errors.Is for any *MigrationError
+	ErrMigrationFailed = errors.New("migration failed")
+)
+
+// VersionError is returned when a migration file name has no valid version
+type VersionError struct {
+	file string
+	err  error
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%v in %v", ErrInvalidVersion, e.file)
+}
+
+// File returns the path of the migration file without version
+func (e *VersionError) File() string {
+	return e.file
+}
+
+// Unwrap returns the error of the version strategy
+func (e *VersionError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is ErrInvalidVersion
+func (e *VersionError) Is(target error) bool {
+	return target == ErrInvalidVersion
+}
+
+// MigrationError is returned when the SQL of a migration file fails
+type MigrationError struct {
+	file string
+	err  error
+}
+
+func (e *MigrationError) Error() string {
+	return e.err.Error()
+}
+
+// File returns the path of the migration file that failed
+func (e *MigrationError) File() string {
+	return e.file
+}
+
+// Unwrap returns the database error
+func (e *MigrationError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is ErrMigrationFailed
+func (e *MigrationError) Is(target error) bool {
+	return target == ErrMigrationFailed
+}
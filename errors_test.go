@@ -0,0 +1,184 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestErrors(t *testing.T) {
+	files := []string{"testdata/001_name.up.sql"}
+	_, errNotFound := targetIndex(SequentialStrategy{}, files, 2)
+	_, errVersion := version(SequentialStrategy{}, "testdata/name.up.sql")
+	_, errSyntax := parsePar([]string{"up", "x"})
+	_, errMissing := requiredPar([]string{"goto"}, "goto")
+	_, _, errEmpty := Run(context.Background(), "./testdata", "", " ")
+	_, _, errParams := Run(context.Background(), "./testdata", "", "up 1 2")
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		msg    string
+	}{
+		{name: "version not found", err: errNotFound, target: ErrVersionNotFound, msg: "migration version not found: 2"},
+		{name: "invalid version", err: errVersion, target: ErrInvalidVersion, msg: "invalid migration version in testdata/name.up.sql"},
+		{name: "invalid syntax", err: errSyntax, target: ErrInvalidSyntax, msg: "invalid syntax"},
+		{name: "missing version", err: errMissing, target: ErrMissingVersion, msg: "goto requires the target version"},
+		{name: "empty action", err: errEmpty, target: ErrEmptyAction, msg: "the migration action is required"},
+		{name: "invalid parameters", err: errParams, target: ErrInvalidParameters, msg: "the number of migration parameters is incorrect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.target) {
+				t.Errorf("expected errors.Is(%v, %v)", tt.err, tt.target)
+			}
+			if tt.err.Error() != tt.msg {
+				t.Errorf("expected message %q but got %q", tt.msg, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestMigrationError(t *testing.T) {
+	dbErr := errors.New(`pq: syntax error at or near "CREATE"`)
+	var err error = &MigrationError{file: "testdata/001_name.up.sql", err: dbErr}
+	if !errors.Is(err, ErrMigrationFailed) {
+		t.Error("expected errors.Is ErrMigrationFailed")
+	}
+	if !errors.Is(err, dbErr) {
+		t.Error("expected errors.Is the database error")
+	}
+	var me *MigrationError
+	if !errors.As(err, &me) {
+		t.Fatal("expected errors.As *MigrationError")
+	}
+	if me.File() != "testdata/001_name.up.sql" {
+		t.Errorf("unexpected file %v", me.File())
+	}
+	if err.Error() != dbErr.Error() {
+		t.Errorf("expected message %q but got %q", dbErr.Error(), err.Error())
+	}
+}
+
+func TestRunPartialFailure(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("SELECT 1;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, executed, err := Run(context.Background(), "migrations", url, "up", WithFS(fsys), PerMigrationTx())
+	var me *MigrationError
+	if !errors.As(err, &me) {
+		t.Fatalf("expected a *MigrationError but got %v", err)
+	}
+	if me.File() != "migrations/002_b.up.sql" {
+		t.Errorf("expected the failing file migrations/002_b.up.sql but got %v", me.File())
+	}
+	if want := []string{"migrations/001_a.up.sql"}; n != 1 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed before the failure but got %v %v", want, n, executed)
+	}
+}
+
+func TestRunPerMigrationTx(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int); INSERT INTO missing (id) VALUES (1);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	tests := []struct {
+		name     string
+		opts     []Option
+		versions []int64
+		tables   []string
+		pending  int
+	}{
+		{name: "batch", versions: []int64{}, pending: 3},
+		{name: "per migration", opts: []Option{PerMigrationTx()}, versions: []int64{1, 2}, tables: []string{"a", "b"}, pending: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+			opts := append([]Option{WithFS(fsys)}, tt.opts...)
+			_, _, err := Run(ctx, "migrations", url, "up", opts...)
+			if !errors.Is(err, ErrMigrationFailed) {
+				t.Fatalf("expected the third migration to fail but got %v", err)
+			}
+			versions, err := appliedVersionsOf(ctx, url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("expected the versions %v kept but got %v", tt.versions, versions)
+			}
+			db, err := sqlx.Open("sqlite", strings.TrimPrefix(url, "sqlite://"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var tables []string
+			err = db.Select(&tables, `SELECT name FROM sqlite_master WHERE type = 'table' AND name IN ('a', 'b', 'c') ORDER BY name`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tables, tt.tables) {
+				t.Errorf("expected the tables %v kept but got %v", tt.tables, tables)
+			}
+			n, _, err := Run(ctx, "migrations", url, "pending", opts...)
+			if err != nil || n != tt.pending {
+				t.Errorf("expected %v migrations pending but got %v %v", tt.pending, n, err)
+			}
+		})
+	}
+}
+
+func TestVersionError(t *testing.T) {
+	_, _, err := Run(context.Background(), "./testdata/noversion", "sqlite://"+filepath.Join(t.TempDir(), "test.db"), "up")
+	if !errors.Is(err, ErrInvalidVersion) {
+		t.Fatalf("expected ErrInvalidVersion but got %v", err)
+	}
+	var ve *VersionError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a *VersionError but got %T", err)
+	}
+	if want := "testdata/noversion/add_users.up.sql"; ve.File() != want {
+		t.Errorf("expected the file without version but got %v", ve.File())
+	}
+	if ve.Unwrap() == nil {
+		t.Error("expected the version strategy error")
+	}
+}
+
+func TestIncompatibleTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE schema_migrations (id integer, name text, run_on timestamp)")
+	db.Close() // nolint
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	_, _, err = Run(context.Background(), "migrations", "sqlite://"+path, "up", WithFS(fsys))
+	if !errors.Is(err, ErrIncompatibleTable) || !strings.Contains(err.Error(), "schema_migrations has no version, checksum, applied_at column, it may belong to another migration tool, use another table") {
+		t.Errorf("expected an incompatible table error but got %v", err)
+	}
+}
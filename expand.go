@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envVarRegexp matches ${NAME} and the escaped $${NAME}
+var envVarRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// escapedVarRegexp matches $${NAME} at the start of the SQL
+var escapedVarRegexp = regexp.MustCompile(`^\$\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// expandVars replaces ${NAME} in the migration SQL with the value
+// of vars, or of the environment variable when vars is nil, the
+// comments are kept as written and $${NAME} is the literal ${NAME},
+// other uses of $ like $1 and $$ are kept
+func expandVars(sql []byte, vars map[string]string) ([]byte, error) {
+	var b strings.Builder
+	err := expandSQL(&b, string(sql), vars)
+	return []byte(b.String()), err
+}
+
+// expandSQL writes sql to b with the variables replaced out of the
+// comments, quoted text and dollar quoted bodies are expanded like
+// the SQL around them, a function body is SQL with its own comments
+func expandSQL(b *strings.Builder, sql string, vars map[string]string) (err error) {
+	var (
+		start int
+		i     int
+	)
+	expand := func(end int) {
+		e := expandText(b, sql[start:end], vars)
+		if err == nil {
+			err = e
+		}
+	}
+	// keep writes sql[i:end] as is
+	keep := func(end int) {
+		expand(i)
+		b.WriteString(sql[i:end])
+		i = end
+		start = end
+	}
+	for i < len(sql) {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			i = skipQuoted(sql, i, c)
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			n := strings.IndexByte(sql[i:], '\n')
+			if n < 0 {
+				keep(len(sql))
+				continue
+			}
+			keep(i + n + 1)
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			n := strings.Index(sql[i+2:], "*/")
+			if n < 0 {
+				keep(len(sql))
+				continue
+			}
+			keep(i + n + 4)
+		case c == '$':
+			if loc := escapedVarRegexp.FindStringIndex(sql[i:]); loc != nil {
+				i += loc[1]
+				continue
+			}
+			end := skipDollarQuoted(sql, i)
+			if end == i+1 {
+				i++
+				continue
+			}
+			tag := sql[i : i+strings.IndexByte(sql[i+1:], '$')+2]
+			if end-i < 2*len(tag) || !strings.HasSuffix(sql[:end], tag) {
+				// the body without the closing tag is expanded as text
+				i = end
+				continue
+			}
+			expand(i)
+			b.WriteString(tag)
+			e := expandSQL(b, sql[i+len(tag):end-len(tag)], vars)
+			if err == nil {
+				err = e
+			}
+			b.WriteString(tag)
+			i = end
+			start = end
+		default:
+			i++
+		}
+	}
+	expand(len(sql))
+	return
+}
+
+// expandText writes sql to b with the variables replaced
+func expandText(b *strings.Builder, sql string, vars map[string]string) (err error) {
+	b.WriteString(envVarRegexp.ReplaceAllStringFunc(sql, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := m[2 : len(m)-1]
+		v, ok := vars[name]
+		if vars == nil {
+			v, ok = os.LookupEnv(name)
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined variable %v", name)
+		}
+		return v
+	}))
+	return
+}
@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_expandVars(t *testing.T) {
+	vars := map[string]string{"SCHEMA": "tenant_a"}
+	tests := []struct {
+		name    string
+		sql     string
+		want    string
+		wantErr bool
+	}{
+		{name: "variable", sql: "CREATE SCHEMA ${SCHEMA};", want: "CREATE SCHEMA tenant_a;"},
+		{name: "dollar quoting", sql: "DO $$ BEGIN PERFORM $1; END $$;", want: "DO $$ BEGIN PERFORM $1; END $$;"},
+		{name: "undefined", sql: "CREATE SCHEMA ${OTHER};", wantErr: true},
+		{name: "comment", sql: "-- was ${OTHER}\nCREATE SCHEMA ${SCHEMA}; /* ${OTHER} */", want: "-- was ${OTHER}\nCREATE SCHEMA tenant_a; /* ${OTHER} */"},
+		{name: "comment in a string", sql: "SELECT '--', '${SCHEMA}';", want: "SELECT '--', 'tenant_a';"},
+		{name: "escape", sql: "SELECT '$${OTHER}', ${SCHEMA};", want: "SELECT '${OTHER}', tenant_a;"},
+		{name: "dollar quoted body", sql: "DO $f$ BEGIN -- ${OTHER}\nCREATE SCHEMA ${SCHEMA}; END $f$;", want: "DO $f$ BEGIN -- ${OTHER}\nCREATE SCHEMA tenant_a; END $f$;"},
+		{name: "unterminated dollar quote", sql: "SELECT $$ ${SCHEMA}", want: "SELECT $$ tenant_a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandVars([]byte(tt.sql), vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("expandVars() = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunExpandVars(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE ${TENANT}_users (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE ${TENANT}_users;")},
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if !errors.Is(err, ErrMigrationFailed) {
+		t.Fatalf("expected the SQL without expansion to fail but got %v", err)
+	}
+	t.Setenv("TENANT", "acme")
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys), ExpandVars(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	err = db.Get(&n, `SELECT count(*) FROM sqlite_master WHERE name = 'acme_users'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Error("expected the acme_users table created")
+	}
+	_, _, err = Run(ctx, "migrations", url, "down", WithFS(fsys), ExpandVars(map[string]string{"TENANT": "acme"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
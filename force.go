@@ -0,0 +1,136 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Force sets the recorded migration version without executing any
+// migration file, rows above version are deleted and the missing rows
+// up to version are inserted, it returns the recorded version before
+// and after forcing, with the Tag option only the rows of the tagged
+// files are deleted
+func Force(ctx context.Context, source, url string, version int64, opts ...Option) (before, after int64, err error) {
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	before, after, err = m.Force(ctx, version)
+	return
+}
+
+// Force sets the recorded migration version like the Force function
+func (m *Migrator) Force(ctx context.Context, version int64) (before, after int64, err error) {
+	unlock, err := m.begin(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	before, after, err = m.force(ctx, version)
+	return
+}
+
+func (m *Migrator) force(ctx context.Context, target int64) (before, after int64, err error) {
+	err = m.destructive("force")
+	if err != nil {
+		return
+	}
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	idx, err := targetIndex(m.opts.strategy, files, target)
+	missing := errors.Is(err, ErrVersionNotFound) && m.opts.allowMissing
+	if missing {
+		idx, err = position(m.opts.strategy, files, target)
+	}
+	if err != nil {
+		return
+	}
+	versions := make([]int64, 0, idx+1)
+	for _, f := range files[:idx] {
+		var v int64
+		v, err = version(m.opts.strategy, f)
+		if err != nil {
+			return
+		}
+		versions = append(versions, v)
+	}
+	if missing {
+		versions = append(versions, target)
+	}
+	before, err = migrationMax(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	if m.opts.dryRun != nil {
+		err = m.printForce(ctx, target, versions)
+		return before, target, err
+	}
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	if m.opts.tag == "" {
+		_, err = tx.ExecContext(ctx, tx.Rebind(m.cfg.query(`DELETE FROM %[1]s WHERE version > ?`)), target)
+	} else {
+		err = m.deleteFiles(ctx, tx, files[idx:])
+	}
+	if err != nil {
+		m.rollback(tx)
+		return
+	}
+	var applied []int64
+	err = tx.SelectContext(ctx, &applied, m.cfg.query(`SELECT version FROM %[1]s`))
+	if err != nil {
+		m.rollback(tx)
+		return
+	}
+	recorded := make(map[int64]bool, len(applied))
+	for _, v := range applied {
+		recorded[v] = true
+	}
+	for i, v := range versions {
+		if recorded[v] {
+			continue
+		}
+		// the target of AllowMissingVersion has no file
+		var file, sum string
+		if i < idx {
+			file = files[i]
+			sum, err = m.upChecksum(file)
+			if err != nil {
+				m.rollback(tx)
+				return
+			}
+		}
+		err = insertMigrations(ctx, v, file, sum, tx, m.cfg)
+		if err != nil {
+			m.rollback(tx)
+			return
+		}
+	}
+	err = m.commit(tx)
+	if err != nil {
+		return
+	}
+	after, err = migrationMax(ctx, m.conn(), m.cfg)
+	return
+}
+
+// printForce writes the changes of force to the DryRun writer
+func (m *Migrator) printForce(ctx context.Context, target int64, versions []int64) error {
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.opts.dryRun, "-- delete %v versions above %v\n", m.cfg.TableName, target) // nolint
+	for _, v := range versions {
+		if !applied[v] {
+			fmt.Fprintf(m.opts.dryRun, "-- insert %v version %v\n", m.cfg.TableName, v) // nolint
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GoMigration is a migration written in Go, it runs in the same
+// transaction that records its version
+type GoMigration func(ctx context.Context, tx *sqlx.Tx) error
+
+type goMigration struct {
+	up   GoMigration
+	down GoMigration
+}
+
+const goMigrationSuffix = "_go_migration."
+
+var (
+	goMigrationsMu sync.RWMutex
+	goMigrations   = map[int64]goMigration{}
+)
+
+// Register adds a Go migration with the version, Go migrations are
+// executed in version order together with the SQL migration files and
+// a version can't have both a SQL file and a Go migration
+func Register(version int64, up, down GoMigration) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+	goMigrations[version] = goMigration{up: up, down: down}
+}
+
+// goFiles return the names used for the registered Go migrations
+// in the files list, direction is up or down
+func goFiles(direction string) (files []string) {
+	goMigrationsMu.RLock()
+	defer goMigrationsMu.RUnlock()
+	for v := range goMigrations {
+		files = append(files, fmt.Sprintf("%03d%v%v", v, goMigrationSuffix, direction))
+	}
+	return
+}
+
+// registeredGo return the Go migration for a name returned by goFiles,
+// ok is false for SQL files and fn is nil when the direction is not registered
+func registeredGo(file string) (fn GoMigration, ok bool) {
+	i := strings.Index(file, goMigrationSuffix)
+	if i < 0 {
+		return
+	}
+	v, err := version(SequentialStrategy{}, file)
+	if err != nil {
+		return
+	}
+	goMigrationsMu.RLock()
+	m, ok := goMigrations[v]
+	goMigrationsMu.RUnlock()
+	if !ok {
+		return
+	}
+	fn = m.up
+	if file[i+len(goMigrationSuffix):] == "down" {
+		fn = m.down
+	}
+	return
+}
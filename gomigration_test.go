@@ -0,0 +1,119 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// withGoMigrations replaces the registered Go migrations during a test
+func withGoMigrations(t *testing.T) {
+	goMigrationsMu.Lock()
+	saved := goMigrations
+	goMigrations = map[int64]goMigration{}
+	goMigrationsMu.Unlock()
+	t.Cleanup(func() {
+		goMigrationsMu.Lock()
+		goMigrations = saved
+		goMigrationsMu.Unlock()
+	})
+}
+
+func Test_goFiles(t *testing.T) {
+	withGoMigrations(t)
+	noop := func(ctx context.Context, tx *sqlx.Tx) error { return nil }
+	Register(4, noop, nil)
+	files, err := upFiles(SequentialStrategy{}, FSSource(osFS{}), "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"testdata/001_name.up.sql",
+		"testdata/002_b_name.up.sql",
+		"testdata/003_a_name.up.sql",
+		"004_go_migration.up",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("upFiles() = %v, want %v", files, want)
+	}
+	if fn, ok := registeredGo("004_go_migration.up"); !ok || fn == nil {
+		t.Error("expected the registered up migration")
+	}
+	if fn, ok := registeredGo("004_go_migration.down"); !ok || fn != nil {
+		t.Error("expected a registered version without down migration")
+	}
+	if _, ok := registeredGo("testdata/001_name.up.sql"); ok {
+		t.Error("expected a SQL file not to be a Go migration")
+	}
+	Register(2, noop, noop)
+	_, err = upFiles(SequentialStrategy{}, FSSource(osFS{}), "testdata")
+	if !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("expected ErrDuplicateVersion but got %v", err)
+	}
+}
+
+func TestRunGoMigration(t *testing.T) {
+	withGoMigrations(t)
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	Register(4,
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO test2 (name) VALUES ('a'), ('b')`)
+			return err
+		},
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM test2`)
+			return err
+		})
+	n, executed, err := Run(context.Background(), source, url, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || executed[3] != "004_go_migration.up" {
+		t.Errorf("expected the Go migration executed last but got %v", executed)
+	}
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	err = db.Get(&count, `SELECT count(*) FROM test2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 rows inserted by the Go migration but got %v", count)
+	}
+	n, _, err = Run(context.Background(), source, url, "down")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected n %v but got %v", 4, n)
+	}
+}
+
+func TestRunLockTimeout(t *testing.T) {
+	withGoMigrations(t)
+	var timeout int
+	Register(1, func(ctx context.Context, tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &timeout, `PRAGMA busy_timeout`)
+	}, func(ctx context.Context, tx *sqlx.Tx) error {
+		return nil
+	})
+	url := fakesqlURL(t)
+	_, _, err := Run(context.Background(), "migrations", url, "up", WithFS(fstest.MapFS{"migrations": {Mode: fs.ModeDir}}), LockTimeout(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 2000 {
+		t.Errorf("expected busy_timeout 2000 but got %v", timeout)
+	}
+}
@@ -0,0 +1,119 @@
+package migration
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// HistoryEntry is an executed migration with the name and the time
+// recorded when it was applied, AppliedAt is nil for migrations
+// executed before it was recorded
+type HistoryEntry struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// History return the executed migrations in the order they were
+// applied, the last applied first if newestFirst is true
+func History(ctx context.Context, source, url string, newestFirst bool, opts ...Option) (h []HistoryEntry, err error) {
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	return m.History(ctx, newestFirst)
+}
+
+// History return the executed migrations in the order they were
+// applied, the last applied first if newestFirst is true
+func (m *Migrator) History(ctx context.Context, newestFirst bool) (h []HistoryEntry, err error) {
+	unlock, err := m.begin(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	return m.history(ctx, newestFirst)
+}
+
+func (m *Migrator) history(ctx context.Context, newestFirst bool) (h []HistoryEntry, err error) {
+	applied, err := appliedMigrations(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	up, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	byVersion, err := fileVersions(m.opts.strategy, up)
+	if err != nil {
+		return
+	}
+	// the migrations without applied_at were executed first, the
+	// same time is ordered by version
+	sort.SliceStable(applied, func(i, j int) bool {
+		a, b := applied[i].AppliedAt, applied[j].AppliedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	h = make([]HistoryEntry, 0, len(applied))
+	for _, a := range applied {
+		e := HistoryEntry{Version: a.Version, Name: a.Name, AppliedAt: a.AppliedAt}
+		if f, ok := byVersion[a.Version]; ok && e.Name == "" {
+			e.Name = migrationName(f)
+		}
+		h = append(h, e)
+	}
+	if newestFirst {
+		for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+			h[i], h[j] = h[j], h[i]
+		}
+	}
+	return
+}
+
+// historyOrder parse the optional order of the history action,
+// history newest or history oldest, the default
+func historyOrder(args []string) (newestFirst bool, err error) {
+	if len(args) < 2 {
+		return
+	}
+	switch args[1] {
+	case "newest":
+		newestFirst = true
+	case "oldest":
+	default:
+		err = ErrInvalidSyntax
+	}
+	return
+}
+
+// historyFiles return the paths of the executed migration files in
+// the order they were applied, the recorded name for a version whose
+// file was removed, the names and times are returned by History
+func (m *Migrator) historyFiles(ctx context.Context, newestFirst bool) (int, []string, error) {
+	h, err := m.history(ctx, newestFirst)
+	if err != nil {
+		return 0, nil, err
+	}
+	up, err := m.upFiles()
+	if err != nil {
+		return 0, nil, err
+	}
+	byVersion, err := fileVersions(m.opts.strategy, up)
+	if err != nil {
+		return 0, nil, err
+	}
+	files := make([]string, 0, len(h))
+	for _, e := range h {
+		f, ok := byVersion[e.Version]
+		if !ok {
+			f = e.Name
+		}
+		files = append(files, f)
+	}
+	return len(files), files, nil
+}
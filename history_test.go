@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestHistory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	start := time.Now().Add(-time.Second)
+	for _, action := range []string{"up 1", "apply 3", "apply 2"} {
+		_, _, err := Run(ctx, "migrations", url, action, WithFS(fsys), AllowOutOfOrder())
+		if err != nil {
+			t.Fatalf("%v: %v", action, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	h, err := History(ctx, "migrations", url, false, WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i, e := range h {
+		names = append(names, e.Name)
+		if e.AppliedAt == nil || e.AppliedAt.Before(start) || e.AppliedAt.After(time.Now()) {
+			t.Errorf("expected the applied time of %v but got %v", e.Name, e.AppliedAt)
+		}
+		if i > 0 && h[i-1].AppliedAt != nil && e.AppliedAt != nil && !h[i-1].AppliedAt.Before(*e.AppliedAt) {
+			t.Errorf("expected %v applied after %v", e.Name, h[i-1].Name)
+		}
+	}
+	if want := []string{"a", "c", "b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected the history %v but got %v", want, names)
+	}
+
+	n, files, err := Run(ctx, "migrations", url, "history newest", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/002_b.up.sql", "migrations/003_c.up.sql", "migrations/001_a.up.sql"}; n != 3 || !reflect.DeepEqual(files, want) {
+		t.Errorf("expected the newest first history %v but got %v %v", want, n, files)
+	}
+	_, _, err = Run(ctx, "migrations", url, "history sideways", WithFS(fsys))
+	if !errors.Is(err, ErrInvalidSyntax) {
+		t.Errorf("expected ErrInvalidSyntax but got %v", err)
+	}
+}
+
+func TestRecordName(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() // nolint
+	// a table of an old release without the name column
+	_, err = db.Exec(`CREATE TABLE schema_migrations (version bigint NOT NULL, checksum text, applied_at timestamp, CONSTRAINT schema_migrations_pkey PRIMARY KEY (version))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"migrations/001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/002_add_orders.up.sql":     {Data: []byte("CREATE TABLE orders (id int);")},
+		"migrations/003_add_invoices.up.sql":   {Data: []byte("CREATE TABLE invoices (id int);")},
+		"migrations/003_add_invoices.down.sql": {Data: []byte("DROP TABLE invoices;")},
+	}
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	err = db.Select(&names, `SELECT name FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", "add_orders", "add_invoices"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected the recorded names %q but got %q", want, names)
+	}
+
+	// the history shows the recorded names, the name of the file for
+	// the versions recorded before the column
+	_, err = db.Exec(`UPDATE schema_migrations SET name = 'renamed' WHERE version = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := History(ctx, "migrations", url, false, WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, e := range h {
+		names = append(names, e.Name)
+	}
+	if want := []string{"create_users", "renamed", "add_invoices"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected the history %v but got %v", want, names)
+	}
+
+	// Run returns the paths of the files, the recorded name of a
+	// removed file
+	delete(fsys, "migrations/002_add_orders.up.sql")
+	_, files, err := Run(ctx, "migrations", url, "history", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/001_create_users.up.sql", "renamed", "migrations/003_add_invoices.up.sql"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("expected the history files %v but got %v", want, files)
+	}
+}
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRunBatchHooks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("INSERT INTO audit (name) VALUES ('001');")},
+		"migrations/001_a.down.sql": {Data: []byte("DELETE FROM audit WHERE name = '001';")},
+		"migrations/002_b.up.sql":   {Data: []byte("INSERT INTO audit (name) VALUES ('002');")},
+		"migrations/002_b.down.sql": {Data: []byte("DELETE FROM audit WHERE name = '002';")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	var after int
+	opts := []Option{
+		WithFS(fsys),
+		BeforeAll(SQLHook(`CREATE TABLE IF NOT EXISTS audit (name text)`)),
+		AfterAll(func(ctx context.Context, tx *sqlx.Tx) error {
+			after++
+			return nil
+		}),
+	}
+	n, _, err := Run(ctx, "migrations", url, "up", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || after != 1 {
+		t.Errorf("expected 2 migrations and 1 after hook but got %v and %v", n, after)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("expected only the migrations recorded but got %v", versions)
+	}
+	failing := AfterAll(func(ctx context.Context, tx *sqlx.Tx) error {
+		return errors.New("fail")
+	})
+	_, _, err = Run(ctx, "migrations", url, "down 1", WithFS(fsys), failing)
+	if !errors.Is(err, ErrMigrationFailed) {
+		t.Fatalf("expected the failing hook to fail the migration but got %v", err)
+	}
+	versions, err = appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("expected the failed migration to roll back but got %v", versions)
+	}
+}
+
+// appliedVersionsOf open the database of url and return its applied versions
+func appliedVersionsOf(ctx context.Context, url string) ([]int64, error) {
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	db, err := open(ctx, url, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return AppliedVersions(ctx, db, cfg)
+}
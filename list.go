@@ -0,0 +1,70 @@
+package migration
+
+import (
+	"context"
+	"path"
+)
+
+// ListedMigration is a migration file and whether it was executed
+type ListedMigration struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+// List return all the migration files in version order with their
+// applied state
+func List(ctx context.Context, source, url string, opts ...Option) (l []ListedMigration, err error) {
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	return m.List(ctx)
+}
+
+// List return all the migration files in version order with their
+// applied state
+func (m *Migrator) List(ctx context.Context) (l []ListedMigration, err error) {
+	unlock, err := m.begin(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	return m.list(ctx)
+}
+
+func (m *Migrator) list(ctx context.Context) (l []ListedMigration, err error) {
+	up, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	l = make([]ListedMigration, 0, len(up))
+	for _, f := range up {
+		var v int64
+		v, err = version(m.opts.strategy, f)
+		if err != nil {
+			return
+		}
+		l = append(l, ListedMigration{
+			Version: v,
+			Name:    path.Base(f),
+			Applied: applied[v],
+		})
+	}
+	return
+}
+
+// listFiles return the number of migration files and their paths,
+// like the files returned by status and pending
+func (m *Migrator) listFiles() (int, []string, error) {
+	up, err := m.upFiles()
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(up), up, nil
+}
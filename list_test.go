@@ -0,0 +1,44 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestList(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.sql":      {Data: []byte("-- +migration Up\nCREATE TABLE c (id int);\n-- +migration Down\nDROP TABLE c;\n")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up 2", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := List(ctx, "migrations", url, WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ListedMigration{
+		{Version: 1, Name: "001_a.up.sql", Applied: true},
+		{Version: 2, Name: "002_b.up.sql", Applied: true},
+		{Version: 3, Name: "003_c.sql"},
+	}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("expected %v but got %v", want, l)
+	}
+	n, names, err := Run(ctx, "migrations", url, "list", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || !reflect.DeepEqual(names, []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql", "migrations/003_c.sql"}) {
+		t.Errorf("expected the 3 migration files but got %v %v", n, names)
+	}
+}
@@ -0,0 +1,185 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// advisoryLockID is the pg_advisory_lock key shared by
+// every instance of the migration tool
+const advisoryLockID int64 = 0x6d6967726174696f // "migratio"
+
+// lockTablePoll is the wait between the attempts to claim the lock table
+const lockTablePoll = 100 * time.Millisecond
+
+// releaseAttempts is the number of attempts to release the lock
+// table, the release can be busy while other runs try the claim
+const releaseAttempts = 50
+
+// lock acquire the migration lock in a dedicated connection, the
+// returned function releases the lock and the connection, the lock
+// table waits at most timeout when it is not 0 and takes over the
+// claims older than ttl when it is not 0
+func lock(ctx context.Context, db *sqlx.DB, cfg *DatabaseConfig, timeout, ttl time.Duration) (unlock func(), err error) {
+	if cfg.LockTable {
+		return tableLock(ctx, db, cfg, timeout, ttl)
+	}
+	if cfg.LockSQL == "" {
+		unlock = func() {}
+		return
+	}
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return
+	}
+	_, err = conn.ExecContext(ctx, lockQuery(cfg, cfg.LockSQL))
+	if err != nil {
+		conn.Close() // nolint
+		err = fmt.Errorf("%w: %v", ErrLock, err)
+		return
+	}
+	unlock = func() {
+		conn.ExecContext(context.Background(), lockQuery(cfg, cfg.UnlockSQL)) // nolint
+		conn.Close()                                                          // nolint
+	}
+	return
+}
+
+// lockQuery return the lock statement with the table name, the
+// statements without verbs, e.g. the advisory lock, are used as is
+func lockQuery(cfg *DatabaseConfig, tmpl string) string {
+	if !strings.Contains(tmpl, "%") {
+		return tmpl
+	}
+	return cfg.query(tmpl)
+}
+
+// lockTableConfig return cfg with the lock table as TableName
+func lockTableConfig(cfg *DatabaseConfig) *DatabaseConfig {
+	c := *cfg
+	c.TableName = cfg.TableName + "_lock"
+	return &c
+}
+
+// lockHolder identifies this process in the lock table
+func lockHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%v pid %v", host, os.Getpid())
+}
+
+// tableLock claims the single row of the lock table, for databases
+// without session locks, e.g. a SQLite file shared by many processes,
+// it retries until the context is done or the timeout expires, a
+// claim older than ttl is taken over when ttl is not 0
+func tableLock(ctx context.Context, db *sqlx.DB, cfg *DatabaseConfig, timeout, ttl time.Duration) (unlock func(), err error) {
+	lc := lockTableConfig(cfg)
+	_, err = db.ExecContext(ctx, lc.query(`CREATE TABLE IF NOT EXISTS %[1]s (id integer NOT NULL, locked integer NOT NULL, locked_at timestamp, holder varchar(255), CONSTRAINT %[3]s PRIMARY KEY (id))`))
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrLock, err)
+		return
+	}
+	// the lock tables of old releases have no holder, a concurrent
+	// run can add it first
+	_, err = db.ExecContext(ctx, lc.query(`SELECT holder FROM %[1]s WHERE 1 = 0`))
+	if err != nil {
+		db.ExecContext(ctx, lc.query(`ALTER TABLE %[1]s ADD holder varchar(255)`)) // nolint
+	}
+	// a concurrent run can insert the row first, the claim tells
+	db.ExecContext(ctx, lc.query(`INSERT INTO %[1]s (id, locked) SELECT 1, 0 WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE id = 1)`)) // nolint
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// the times are compared in UTC by the database, the stale claims
+	// are taken over in the same statement so only one run wins them
+	claim := db.Rebind(lc.query(`UPDATE %[1]s SET locked = 1, locked_at = ?, holder = ? WHERE id = 1 AND (locked = 0 OR locked_at < ?)`))
+	holder := lockHolder()
+	for {
+		now := time.Now().UTC()
+		stale := time.Time{}
+		if ttl > 0 {
+			stale = now.Add(-ttl)
+		}
+		var res sql.Result
+		res, err = db.ExecContext(ctx, claim, now, holder, stale)
+		if err == nil {
+			var rows int64
+			rows, err = res.RowsAffected()
+			if err == nil && rows == 1 {
+				break
+			}
+			if err == nil {
+				err = errClaimed(db, lc)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("%w: %v table: %w", ErrLock, lc.TableName, err)
+			return
+		case <-time.After(lockTablePoll):
+		}
+	}
+	// a run whose stale claim was taken over leaves the new claim
+	release := db.Rebind(lc.query(`UPDATE %[1]s SET locked = 0, locked_at = NULL, holder = NULL WHERE id = 1 AND holder = ?`))
+	unlock = func() {
+		for i := 0; i < releaseAttempts; i++ {
+			_, err := db.ExecContext(context.Background(), release, holder)
+			if err == nil {
+				return
+			}
+			time.Sleep(lockTablePoll)
+		}
+	}
+	return
+}
+
+// errClaimed describes the run holding the lock table and how to
+// release it when that run was killed
+func errClaimed(db *sqlx.DB, lc *DatabaseConfig) error {
+	var claim struct {
+		Holder   sql.NullString `db:"holder"`
+		LockedAt sql.NullTime   `db:"locked_at"`
+	}
+	err := db.Get(&claim, lc.query(`SELECT holder, locked_at FROM %[1]s WHERE id = 1`))
+	if err != nil || !claim.Holder.Valid || !claim.LockedAt.Valid {
+		return errors.New("locked by another run, if it was killed release the lock with the unlock action, migration exec -action unlock")
+	}
+	return fmt.Errorf("locked by %v since %v, if it was killed release the lock with the unlock action, migration exec -action unlock",
+		claim.Holder.String, claim.LockedAt.Time.Local().Format(time.RFC3339))
+}
+
+// releaseTable frees the row of the lock table
+func releaseTable(ctx context.Context, db sqlx.ExecerContext, lc *DatabaseConfig) error {
+	_, err := db.ExecContext(ctx, lc.query(`UPDATE %[1]s SET locked = 0, locked_at = NULL, holder = NULL WHERE id = 1`))
+	return err
+}
+
+// forceUnlock releases the lock table left claimed by a run that
+// was killed, the session locks are released by the database when
+// the connection is closed so there is nothing to do for them
+func (m *Migrator) forceUnlock(ctx context.Context) error {
+	if !m.cfg.LockTable {
+		return nil
+	}
+	lc := lockTableConfig(m.cfg)
+	exists, err := schemaMigrationsExists(ctx, m.conn(), lc)
+	if err != nil || !exists {
+		return err
+	}
+	err = releaseTable(ctx, m.conn(), lc)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLock, err)
+	}
+	return nil
+}
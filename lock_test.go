@@ -0,0 +1,203 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, _, err := Run(context.Background(), source, url, "up")
+			if err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if total != 3 {
+		t.Errorf("expected 3 migrations executed by both runners but got %v", total)
+	}
+	_, _, err := Run(context.Background(), source, url, "down")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockQuery(t *testing.T) {
+	ms := sqlserverConfig
+	ms.TableName = "app_schema_migrations"
+	want := `EXEC sp_getapplock @Resource = 'app_schema_migrations', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = -1`
+	if got := lockQuery(&ms, ms.LockSQL); got != want {
+		t.Errorf("expected the lock %v but got %v", want, got)
+	}
+	want = `EXEC sp_releaseapplock @Resource = 'app_schema_migrations', @LockOwner = 'Session'`
+	if got := lockQuery(&ms, ms.UnlockSQL); got != want {
+		t.Errorf("expected the unlock %v but got %v", want, got)
+	}
+	if got := lockQuery(&postgresConfig, postgresConfig.LockSQL); got != postgresConfig.LockSQL {
+		t.Errorf("expected the advisory lock %v but got %v", postgresConfig.LockSQL, got)
+	}
+}
+
+func TestLockTable(t *testing.T) {
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	first, err := open(ctx, url, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := open(ctx, url, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	unlock, err := lock(ctx, first, cfg, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = lock(ctx, second, cfg, 3*lockTablePoll, 0)
+	if !errors.Is(err, ErrLock) {
+		t.Errorf("expected ErrLock while the lock is claimed but got %v", err)
+	}
+	if d := time.Since(start); d < 3*lockTablePoll {
+		t.Errorf("expected the second claimant to retry until the timeout but it gave up after %v", d)
+	}
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys), LockTimeout(lockTablePoll))
+	if !errors.Is(err, ErrLock) {
+		t.Errorf("expected Run to fail with ErrLock but got %v", err)
+	}
+
+	unlock()
+	unlock, err = lock(ctx, second, cfg, time.Second, 0)
+	if err != nil {
+		t.Fatalf("expected the lock after the release but got %v", err)
+	}
+	unlock()
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil || n != 1 {
+		t.Errorf("expected the migration executed after the release but got %v %v", n, err)
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	db, err := open(ctx, url, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	}
+	_, _, err = Run(ctx, "migrations", url, "unlock", WithFS(fsys))
+	if err != nil {
+		t.Fatalf("expected unlock without a lock table to do nothing but got %v", err)
+	}
+	// a killed run never releases its claim
+	_, err = lock(ctx, db, cfg, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys), LockTimeout(lockTablePoll))
+	if !errors.Is(err, ErrLock) {
+		t.Fatalf("expected ErrLock with the stale claim but got %v", err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "unlock", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), LockTimeout(lockTablePoll))
+	if err != nil || n != 1 {
+		t.Errorf("expected the migration executed after unlock but got %v %v", n, err)
+	}
+}
+
+func TestLockTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	db, err := open(ctx, url, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the lock table of an old release without the holder
+	_, err = db.Exec(`CREATE TABLE schema_migrations_lock (id integer NOT NULL, locked integer NOT NULL, locked_at timestamp, CONSTRAINT schema_migrations_lock_pkey PRIMARY KEY (id))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a killed run never releases its claim
+	_, err = lock(ctx, db, cfg, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	}
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys), LockTimeout(lockTablePoll), LockTTL(time.Hour))
+	if !errors.Is(err, ErrLock) || !strings.Contains(err.Error(), lockHolder()) || !strings.Contains(err.Error(), "unlock") {
+		t.Fatalf("expected ErrLock naming the holder and the unlock action but got %v", err)
+	}
+	_, err = db.Exec(`UPDATE schema_migrations_lock SET locked_at = ?`, time.Now().UTC().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), LockTimeout(lockTablePoll))
+	if !errors.Is(err, ErrLock) {
+		t.Errorf("expected ErrLock without a ttl but got %v %v", n, err)
+	}
+	n, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys), LockTimeout(lockTablePoll), LockTTL(time.Hour))
+	if err != nil || n != 1 {
+		t.Errorf("expected the stale claim taken over but got %v %v", n, err)
+	}
+	var locked int
+	err = db.Get(&locked, `SELECT locked FROM schema_migrations_lock`)
+	if err != nil || locked != 0 {
+		t.Errorf("expected the lock released after the run but got %v %v", locked, err)
+	}
+}
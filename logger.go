@@ -0,0 +1,29 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+)
+
+// Logger receives the migration events, kv are key value pairs like
+// "version", 1, "file", "001_a.up.sql", a *slog.Logger is a Logger
+type Logger interface {
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// textLogger is the default Logger, it only writes the warnings
+// to w because the errors are returned and the cli prints the
+// executed migrations
+type textLogger struct {
+	w io.Writer
+}
+
+func (textLogger) Info(string, ...any) {}
+
+func (l textLogger) Warn(msg string, _ ...any) {
+	fmt.Fprintf(l.w, "warning: %v\n", msg) // nolint
+}
+
+func (textLogger) Error(string, ...any) {}
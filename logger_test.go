@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ Logger = (*slog.Logger)(nil)
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) log(level, msg string, kv ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(append([]any{level, msg}, kv...)...))
+}
+
+func (l *recordLogger) Info(msg string, kv ...any)  { l.log("info", msg, kv...) }
+func (l *recordLogger) Warn(msg string, kv ...any)  { l.log("warn", msg, kv...) }
+func (l *recordLogger) Error(msg string, kv ...any) { l.log("error", msg, kv...) }
+
+func Test_textLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := textLogger{w: &buf}
+	l.Info("migration applied", "version", 1)
+	l.Warn("checksum mismatch", "file", "001_a.up.sql")
+	l.Error("migration failed", "version", 1)
+	want := "warning: checksum mismatch\n"
+	if buf.String() != want {
+		t.Errorf("expected %q but got %q", want, buf.String())
+	}
+}
+
+func TestRunLogger(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	l := &recordLogger{}
+	n, _, err := Run(context.Background(), source, url, "up", WithLogger(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.lines) != n {
+		t.Errorf("expected %v log lines but got %v: %v", n, len(l.lines), l.lines)
+	}
+	_, _, err = Run(context.Background(), source, url, "down")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunConnectRetries(t *testing.T) {
+	url := "postgres://postgres@localhost:1/test?sslmode=disable&connect_timeout=1"
+	l := &recordLogger{}
+	_, _, err := Run(context.Background(), "./testdata", url, "up", WithLogger(l), ConnectRetries(3), ConnectBackoff(time.Millisecond))
+	if !errors.Is(err, ErrOpenDatabase) && !errors.Is(err, ErrPingDatabase) {
+		t.Fatalf("expected a connection error but got %v", err)
+	}
+	if len(l.lines) != 3 {
+		t.Errorf("expected 3 retries but got %v: %v", len(l.lines), l.lines)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = Run(ctx, "./testdata", url, "up", ConnectRetries(3), ConnectBackoff(time.Hour), Warnings(io.Discard))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the retries to stop when the context is canceled but got %v", err)
+	}
+}
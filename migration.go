@@ -1,281 +1,1343 @@
 package migration
 
 import (
+	"bytes"
 	"context"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
+	"io"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
-	"golang.org/x/xerrors"
 )
 
 // upFiles search for migration up files and return
 // a sorted array with the path of all found files
-func upFiles(dir string) (files []string, err error) {
-	files, err = filepath.Glob(filepath.Join(dir, "*.up.sql"))
+func upFiles(vs VersionStrategy, src Source, dir string) (files []string, err error) {
+	files, err = globFiles(vs, src, dir, "up")
 	return
 }
 
-// downFiles search for migration down files and return
-// a sorted array with the path of all found files
-func downFiles(dir string, n int) (files []string, err error) {
-	files, err = filepath.Glob(filepath.Join(dir, "*.down.sql"))
-	sort.Sort(sort.Reverse(sort.StringSlice(files)))
-	files = files[len(files)-n:]
+// downFiles return the down files of the applied versions from
+// the last to the first, each down file must match the version of
+// the up file executed
+func downFiles(vs VersionStrategy, src Source, dir string, applied []int64) (files []string, err error) {
+	up, err := globFiles(vs, src, dir, "up")
+	if err != nil {
+		return
+	}
+	down, err := globFiles(vs, src, dir, "down")
+	if err != nil {
+		return
+	}
+	err = missingUp(vs, up, applied)
+	if err != nil {
+		return
+	}
+	files, err = matchDown(vs, up, down, applied)
+	return
+}
+
+// upFiles return the up files of the migrations source
+// with the Tag option filter
+func (m *Migrator) upFiles() (files []string, err error) {
+	files, err = upFiles(m.opts.strategy, m.opts.src, m.source)
+	files = withTag(files, m.opts.tag)
 	return
 }
 
-func up(ctx context.Context, source string, start, n int, db *sqlx.DB) (number int, executed []string, err error) {
-	files, err := upFiles(source)
+// downFiles return the down files of the applied versions
+// with the Tag option filter
+func (m *Migrator) downFiles(applied []int64) (files []string, err error) {
+	up, err := globFiles(m.opts.strategy, m.opts.src, m.source, "up")
+	if err != nil {
+		return
+	}
+	down, err := globFiles(m.opts.strategy, m.opts.src, m.source, "down")
 	if err != nil {
 		return
 	}
-	number, executed, err = execUp(ctx, files, start, n, db)
+	err = missingUp(m.opts.strategy, up, applied)
+	if err != nil {
+		return
+	}
+	files, err = matchDown(m.opts.strategy, withTag(up, m.opts.tag), withTag(down, m.opts.tag), applied)
 	return
 }
 
-func down(ctx context.Context, source string, start, n int, db *sqlx.DB) (number int, executed []string, err error) {
-	nfiles, err := migrationMax(ctx, db)
+// withTag return the files with tag in the name after the
+// version, all files when tag is empty
+func withTag(files []string, tag string) []string {
+	if tag == "" {
+		return files
+	}
+	var tagged []string
+	for _, f := range files {
+		name := path.Base(f)
+		if i := strings.IndexByte(name, '_'); i >= 0 {
+			name = name[i+1:]
+		}
+		if strings.Contains(name, tag) {
+			tagged = append(tagged, f)
+		}
+	}
+	return tagged
+}
+
+// deleteFiles deletes the recorded versions of files, it scopes the
+// deletes of force and baseline to the files of the Tag option, the
+// rows of the other tags sharing the table are kept
+func (m *Migrator) deleteFiles(ctx context.Context, tx *sqlx.Tx, files []string) error {
+	for _, f := range files {
+		v, err := version(m.opts.strategy, f)
+		if err != nil {
+			return err
+		}
+		err = deleteMigrations(ctx, v, tx, m.cfg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingUp fails with ErrMissingUpFile when an applied version
+// has no up file
+func missingUp(vs VersionStrategy, up []string, applied []int64) error {
+	byVersion, err := fileVersions(vs, up)
+	if err != nil {
+		return err
+	}
+	for _, v := range applied {
+		if _, ok := byVersion[v]; !ok {
+			return fmt.Errorf("%w for executed migration %v", ErrMissingUpFile, v)
+		}
+	}
+	return nil
+}
+
+// matchDown return the down files matching the up files with
+// an applied version from the last to the first
+func matchDown(vs VersionStrategy, up, down []string, applied []int64) (files []string, err error) {
+	byVersion, err := fileVersions(vs, down)
 	if err != nil {
 		return
 	}
-	if n == 0 {
-		n = nfiles
+	executed := make(map[int64]bool, len(applied))
+	for _, v := range applied {
+		executed[v] = true
+	}
+	for i := len(up) - 1; i >= 0; i-- {
+		var v int64
+		v, err = version(vs, up[i])
+		if err != nil {
+			return
+		}
+		if !executed[v] {
+			continue
+		}
+		f, ok := byVersion[v]
+		if !ok {
+			err = fmt.Errorf("%w for %v", ErrMissingDownFile, up[i])
+			return
+		}
+		files = append(files, f)
+	}
+	return
+}
+
+// sourceDirs split the comma separated list of migration directories
+func sourceDirs(source string) (dirs []string) {
+	for _, d := range strings.Split(source, ",") {
+		d = strings.TrimSpace(d)
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	return
+}
+
+// globFiles search the direction files and the single file migrations
+// in all migration directories, add the registered Go migrations and
+// return the files sorted by version, two files can't have the same version
+func globFiles(vs VersionStrategy, src Source, source, direction string) (files []string, err error) {
+	for _, dir := range sourceDirs(source) {
+		var f []string
+		for _, pattern := range []string{"*.sql", "*.sql" + templateSuffix} {
+			f, err = src.List(path.Join(dir, pattern))
+			if err != nil {
+				return
+			}
+			for _, file := range f {
+				name := strings.TrimSuffix(file, templateSuffix)
+				if strings.HasSuffix(name, "."+direction+".sql") {
+					files = append(files, file)
+					continue
+				}
+				if _, err := version(vs, file); err == nil && isCombined(file) {
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	files = append(files, goFiles(direction)...)
+	versions := make(map[string]int64, len(files))
+	seen := make(map[int64]string, len(files))
+	for _, f := range files {
+		var v int64
+		v, err = version(vs, f)
+		if err != nil {
+			return
+		}
+		if dup, ok := seen[v]; ok {
+			err = fmt.Errorf("%w %v in %v and %v", ErrDuplicateVersion, v, dup, f)
+			return
+		}
+		seen[v] = f
+		versions[f] = v
 	}
-	files, err := downFiles(source, nfiles)
+	sort.SliceStable(files, func(i, j int) bool {
+		return compareVersions(vs, versions[files[i]], versions[files[j]]) < 0
+	})
+	return
+}
+
+func (m *Migrator) down(ctx context.Context, start, n int) (number int, executed []string, err error) {
+	err = m.destructive("down")
+	if err != nil {
+		return
+	}
+	applied, err := appliedVersions(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	files, err := m.downFiles(applied)
 	if err != nil {
 		return
 	}
-	number, executed, err = execDown(ctx, files, start, n, db)
+	if n == 0 || n > len(files) {
+		// down more than the executed migrations reverts all of them
+		n = len(files)
+	}
+	number, executed, err = m.execDown(ctx, files, start, n)
 	return
 }
 
-func execDown(ctx context.Context, files []string, start, n int, db *sqlx.DB) (number int, executed []string, err error) {
-	i := len(files)
-	if i == 0 {
+func (m *Migrator) execDown(ctx context.Context, files []string, start, n int) (int, []string, error) {
+	return m.batchTx(ctx, func() (int, []string, error) {
+		return m.execDownBatch(ctx, files, start, n)
+	})
+}
+
+func (m *Migrator) execDownBatch(ctx context.Context, files []string, start, n int) (number int, executed []string, err error) {
+	if len(files) == 0 {
+		return
+	}
+	if start > n || n > len(files) {
+		err = fmt.Errorf("%w, %v migrations requested but %v down files found", ErrMissingDownFile, n-start, len(files))
+		return
+	}
+	batch := files[start:n]
+	err = checkReversible(m.opts.src, batch)
+	if err != nil {
 		return
 	}
-	for k, f := range files[start:n] {
-		var b []byte
-		b, err = os.ReadFile(f) // nolint
+	m.warnDDL(len(batch))
+	for k, f := range batch {
+		var v int64
+		v, err = version(m.opts.strategy, f)
 		if err != nil {
 			return
 		}
-		var tx *sqlx.Tx
-		tx, err = db.Beginx()
+		if m.opts.dryRun != nil {
+			err = m.printDryRun(m.opts.dryRun, f, "down", m.cfg.TableName, v)
+		} else if m.opts.fake {
+			err = m.fake(ctx, v, f, func(tx *sqlx.Tx, _ string) error {
+				return deleteMigrations(ctx, v, tx, m.cfg)
+			})
+		} else {
+			before, after := m.batchHooks(k, len(batch))
+			err = m.apply(ctx, "down", v, f, before, after, func(tx *sqlx.Tx, _ string) error {
+				return deleteMigrations(ctx, v, tx, m.cfg)
+			})
+		}
 		if err != nil {
 			return
 		}
-		_, err = tx.ExecContext(ctx, string(b))
+		number = k + 1
+		executed = append(executed, f)
+	}
+	return
+}
+
+// execUp executes n files from start, all the files after start if
+// n is 0 or greater than the files left
+func (m *Migrator) execUp(ctx context.Context, files []string, start, n int) (int, []string, error) {
+	return m.batchTx(ctx, func() (int, []string, error) {
+		return m.execUpBatch(ctx, files, start, n)
+	})
+}
+
+func (m *Migrator) execUpBatch(ctx context.Context, files []string, start, n int) (number int, executed []string, err error) {
+	end := len(files)
+	if n > 0 {
+		end = min(start+n, end)
+	}
+	batch := files[min(start, end):end]
+	if m.opts.requireDown {
+		err = m.requireDown(batch)
 		if err != nil {
-			tx.Rollback() // nolint
 			return
 		}
-		err = deleteMigrations(ctx, i, tx)
+	}
+	m.warnDDL(len(batch))
+	for k, f := range batch {
+		var v int64
+		v, err = version(m.opts.strategy, f)
 		if err != nil {
-			tx.Rollback() // nolint
 			return
 		}
-		err = tx.Commit()
+		if m.opts.dryRun != nil {
+			err = m.printDryRun(m.opts.dryRun, f, "up", m.cfg.TableName, v)
+		} else if m.opts.fake {
+			err = m.fake(ctx, v, f, func(tx *sqlx.Tx, sum string) error {
+				return insertMigrations(ctx, v, f, sum, tx, m.cfg)
+			})
+		} else {
+			before, after := m.batchHooks(k, len(batch))
+			err = m.apply(ctx, "up", v, f, before, after, func(tx *sqlx.Tx, sum string) error {
+				return insertMigrations(ctx, v, f, sum, tx, m.cfg)
+			})
+		}
+		if errors.Is(err, errAlreadyApplied) {
+			err = nil
+			continue
+		}
 		if err != nil {
 			return
 		}
-		i--
-		number = k + 1
+		number++
 		executed = append(executed, f)
 	}
 	return
 }
 
-func execUp(ctx context.Context, files []string, start, n int, db *sqlx.DB) (number int, executed []string, err error) {
-	if n == 0 {
-		n = len(files)
+// batchTx runs fn with the migrations of the batch in one transaction,
+// a failure rolls the whole batch back and nothing is returned as
+// executed, fn runs as is with PerMigrationTx, RunWithTx, a dry run or
+// a database without transactional DDL, where it can't be rolled back
+func (m *Migrator) batchTx(ctx context.Context, fn func() (int, []string, error)) (number int, executed []string, err error) {
+	if m.opts.perMigrationTx || m.tx != nil || m.opts.dryRun != nil || !m.cfg.SupportsTransactionalDDL {
+		return fn()
 	}
-	i := start + 1
-	for k, f := range files[start:n] {
-		var b []byte
-		b, err = os.ReadFile(f) // nolint
+	for attempt := 0; ; attempt++ {
+		var tx *sqlx.Tx
+		tx, err = m.db.BeginTxx(ctx, nil)
 		if err != nil {
 			return
 		}
-		var tx *sqlx.Tx
-		tx, err = db.Beginx()
+		m.tx = tx
+		number, executed, err = fn()
+		m.tx = nil
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback() // nolint
+		}
+		if err == nil {
+			return
+		}
+		if number > 0 {
+			m.opts.log.Warn("migration batch rolled back", "files", executed)
+		}
+		if attempt >= m.cfg.Retries || !retryable(err) {
+			return 0, nil, err
+		}
+	}
+}
+
+// warnDDL warns before executing n migrations when the engine
+// commits DDL statements outside the migration transaction
+func (m *Migrator) warnDDL(n int) {
+	if n == 0 || m.opts.dryRun != nil || m.cfg.SupportsTransactionalDDL {
+		return
+	}
+	m.opts.log.Warn(fmt.Sprintf("%v doesn't support transactional DDL, a failed migration can leave the schema partially migrated", m.cfg.DatabaseType), "database", m.cfg.DatabaseType)
+}
+
+// batchHooks return the BeforeAll hook for the first migration of a
+// batch of n migrations and the AfterAll hook for the last one
+func (m *Migrator) batchHooks(k, n int) (before, after GoMigration) {
+	if k == 0 {
+		before = m.opts.beforeAll
+	}
+	if k == n-1 {
+		after = m.opts.afterAll
+	}
+	return
+}
+
+// apply executes before, the schema_migrations change done by record,
+// the migration file and after in a single transaction, record receives
+// the checksum of the file, the result is logged with its duration
+func (m *Migrator) apply(ctx context.Context, direction string, v int64, file string, before, after GoMigration, record func(tx *sqlx.Tx, sum string) error) (err error) {
+	start := time.Now()
+	err = m.exec(ctx, direction, file, before, after, record)
+	if errors.Is(err, errAlreadyApplied) {
+		m.opts.log.Info("migration already applied", "version", v, "file", file)
+		return
+	}
+	if err != nil {
+		m.opts.log.Error("migration failed", "version", v, "file", file, "error", err)
+		return
+	}
+	d := time.Since(start)
+	m.opts.log.Info("migration applied", "version", v, "file", file, "duration", d)
+	if m.opts.onApplied != nil {
+		m.opts.onApplied(file, d)
+	}
+	return
+}
+
+// fake changes schema_migrations with record without executing the file
+func (m *Migrator) fake(ctx context.Context, v int64, file string, record func(tx *sqlx.Tx, sum string) error) (err error) {
+	_, sum, err := m.migrationFunc(file, "up")
+	if err != nil {
+		return
+	}
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	err = record(tx, sum)
+	if err != nil {
+		m.rollback(tx)
+		return
+	}
+	err = m.commit(tx)
+	if err != nil {
+		return
+	}
+	m.opts.log.Info("migration faked", "version", v, "file", file)
+	return
+}
+
+// exec executes the migration transaction, it is executed
+// again on serialization failures up to cfg.Retries times
+func (m *Migrator) exec(ctx context.Context, direction, file string, before, after GoMigration, record func(tx *sqlx.Tx, sum string) error) (err error) {
+	for attempt := 0; ; attempt++ {
+		err = m.execTx(ctx, direction, file, before, after, record)
+		if attempt >= m.cfg.Retries || m.tx != nil || !retryable(err) {
+			return
+		}
+	}
+}
+
+// execTx records the migration before executing it, so a version
+// already recorded by a concurrent run is skipped
+func (m *Migrator) execTx(ctx context.Context, direction, file string, before, after GoMigration, record func(tx *sqlx.Tx, sum string) error) (err error) {
+	run, sum, err := m.migrationFunc(file, direction)
+	if err != nil {
+		return
+	}
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	if m.opts.lockTimeout > 0 && m.cfg.LockTimeoutSQL != "" {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(m.cfg.LockTimeoutSQL, m.opts.lockTimeout.Milliseconds()))
 		if err != nil {
+			m.rollback(tx)
 			return
 		}
-		_, err = tx.ExecContext(ctx, string(b))
+	}
+	if before != nil {
+		err = before(ctx, tx)
 		if err != nil {
-			tx.Rollback() // nolint
+			m.rollback(tx)
+			err = &MigrationError{file: file, err: fmt.Errorf("before all hook: %w", err)}
 			return
 		}
-		err = insertMigrations(ctx, i, tx)
+	}
+	err = record(tx, sum)
+	if errors.Is(err, errAlreadyApplied) {
+		m.rollback(tx)
+		return
+	}
+	if err != nil {
+		m.rollback(tx)
+		err = &MigrationError{file: file, err: err}
+		return
+	}
+	err = run(ctx, tx)
+	if err != nil {
+		m.rollback(tx)
+		err = &MigrationError{file: file, err: err}
+		return
+	}
+	if after != nil {
+		err = after(ctx, tx)
 		if err != nil {
-			tx.Rollback() // nolint
+			m.rollback(tx)
+			err = &MigrationError{file: file, err: fmt.Errorf("after all hook: %w", err)}
 			return
 		}
-		err = tx.Commit()
+	}
+	err = m.commit(tx)
+	if err != nil {
+		err = &MigrationError{file: file, err: err}
+	}
+	return
+}
+
+// utf8BOM is removed from the start of the migration files, some
+// editors add it and the databases fail with a syntax error
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// migrationFunc return the registered Go migration or a function that
+// executes the SQL file and its checksum, Go migrations have no checksum
+func (m *Migrator) migrationFunc(file, direction string) (run GoMigration, sum string, err error) {
+	if fn, ok := registeredGo(file); ok {
+		if fn == nil {
+			err = fmt.Errorf("%v is not registered", file)
+		}
+		run = fn
+		return
+	}
+	b, err := readMigration(m.opts.src, file, direction)
+	if err != nil {
+		return
+	}
+	sum = checksum(b)
+	if isTemplate(file) {
+		b, err = m.render(file, b)
 		if err != nil {
+			err = fmt.Errorf("%v: %w", file, err)
 			return
 		}
-		i++
-		number = k + 1
-		executed = append(executed, f)
 	}
+	run, err = m.sqlFunc(file, b)
+	return
+}
+
+// sqlFunc return a function that executes the SQL of file
+func (m *Migrator) sqlFunc(file string, b []byte) (run GoMigration, err error) {
+	b = bytes.TrimPrefix(b, utf8BOM)
+	if !utf8.Valid(b) {
+		m.opts.log.Warn(fmt.Sprintf("%v is not valid UTF-8", file), "file", file)
+	}
+	d, err := parseDirectives(b)
+	if err != nil {
+		err = fmt.Errorf("%v: %w", file, err)
+		return
+	}
+	if m.opts.expand {
+		b, err = expandVars(b, m.opts.vars)
+		if err != nil {
+			err = fmt.Errorf("%v: %w", file, err)
+			return
+		}
+	}
+	statements := []string{string(b)}
+	if m.opts.split || m.cfg.SplitStatements {
+		statements = splitStatements(string(b))
+	}
+	verbose := m.opts.verbose
+	sql := string(b)
+	run = func(ctx context.Context, tx *sqlx.Tx) error {
+		start := 0
+		for _, s := range statements {
+			if verbose != nil {
+				fmt.Fprintf(verbose, "-- %v\n%v\n", file, strings.TrimSpace(s)) // nolint
+			}
+			if i := strings.Index(sql[start:], s); i >= 0 {
+				start += i
+			}
+			_, err := tx.ExecContext(ctx, s)
+			if err != nil {
+				return withPosition(err, sql, s, start)
+			}
+			start += len(s)
+		}
+		return nil
+	}
+	if d.timeout > 0 {
+		run = m.withTimeout(run, d.timeout)
+	}
+	return
+}
+
+// withTimeout limits the execution time of run with the statement
+// timeout of the database or with the context deadline
+func (m *Migrator) withTimeout(run GoMigration, timeout time.Duration) GoMigration {
+	setSQL, resetSQL := m.cfg.StatementTimeoutSQL, m.cfg.ResetStatementTimeoutSQL
+	return func(ctx context.Context, tx *sqlx.Tx) error {
+		if setSQL == "" {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return run(ctx, tx)
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(setSQL, timeout.Milliseconds()))
+		if err != nil {
+			return err
+		}
+		err = run(ctx, tx)
+		if err != nil || resetSQL == "" {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, resetSQL)
+		return err
+	}
+}
+
+// printDryRun writes the migration file contents, rendered for the
+// templates, and the schema_migrations change that would be done to w
+func (m *Migrator) printDryRun(w io.Writer, file, direction, table string, version int64) (err error) {
+	b := []byte("-- Go migration")
+	if _, ok := registeredGo(file); !ok {
+		b, err = readMigration(m.opts.src, file, direction)
+		if err != nil {
+			return
+		}
+	}
+	if isTemplate(file) {
+		b, err = m.render(file, b)
+		if err != nil {
+			return fmt.Errorf("%v: %w", file, err)
+		}
+	}
+	op := "insert"
+	if direction == "down" {
+		op = "delete"
+	}
+	_, err = fmt.Fprintf(w, "-- %v\n%s\n-- %v %v version %v\n\n", file, bytes.TrimSpace(b), op, table, version)
 	return
 }
 
 func parsePar(m []string) (n int, err error) {
 	if len(m) > 1 {
 		n, err = strconv.Atoi(m[1])
-		if err != nil {
-			err = xerrors.Errorf("invalid syntax")
+		if err != nil || n < 0 {
+			err = ErrInvalidSyntax
 			return
 		}
 	}
 	return
 }
 
+// requiredPar parse the version parameter of the action
+func requiredPar(m []string, action string) (v int64, err error) {
+	if len(m) != 2 {
+		err = fmt.Errorf("%v %w", action, ErrMissingVersion)
+		return
+	}
+	v, err = strconv.ParseInt(m[1], 10, 64)
+	if err != nil || v < 0 {
+		err = ErrInvalidSyntax
+	}
+	return
+}
+
+// parseAction split the action and its parameter
+func parseAction(migrate string) (args []string, err error) {
+	if strings.TrimSpace(migrate) == "" {
+		err = ErrEmptyAction
+		return
+	}
+	args = strings.Split(migrate, " ")
+	if len(args) > 2 && args[0] != "run" {
+		err = ErrInvalidParameters
+	}
+	return
+}
+
 // Run parse and performs the required migration
-func Run(ctx context.Context, source, url, migrate string) (n int, executed []string, err error) {
-	db, err := open(ctx, url)
+func Run(ctx context.Context, source, url, migrate string, opts ...Option) (n int, executed []string, err error) {
+	_, err = parseAction(migrate)
+	if err != nil {
+		return
+	}
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	n, executed, err = m.Run(ctx, migrate)
+	return
+}
+
+// RunWithExistingDatabase parse and performs the required migration
+// using an already open database, a nil cfg is chosen by the driver name
+func RunWithExistingDatabase(ctx context.Context, source string, db *sqlx.DB, cfg *DatabaseConfig, migrate string, opts ...Option) (int, []string, error) {
+	m, err := NewMigrator(db, cfg, source, opts...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return m.Run(ctx, migrate)
+}
+
+// RunActions performs the actions in order using an already open
+// database, e.g. "down 1" and "up 1", it stops at the first error and
+// return the total number of migrations and the files of all actions
+func RunActions(ctx context.Context, source string, db *sqlx.DB, cfg *DatabaseConfig, actions ...string) (n int, executed []string, err error) {
+	if len(actions) == 0 {
+		err = ErrEmptyAction
+		return
+	}
+	for _, action := range actions {
+		_, err = parseAction(action)
+		if err != nil {
+			return
+		}
+	}
+	m, err := NewMigrator(db, cfg, source)
+	if err != nil {
+		return
+	}
+	for _, action := range actions {
+		var (
+			c     int
+			files []string
+		)
+		c, files, err = m.Run(ctx, action)
+		n += c
+		executed = append(executed, files...)
+		if err != nil {
+			err = fmt.Errorf("%v: %w", action, err)
+			return
+		}
+	}
+	return
+}
+
+// RunWithTx parse and performs the required migration in a transaction
+// of the caller, commit and rollback are left to the caller, no lock is
+// acquired, a nil cfg is chosen by the driver name
+func RunWithTx(ctx context.Context, source string, tx *sqlx.Tx, cfg *DatabaseConfig, migrate string, opts ...Option) (int, []string, error) {
+	if cfg == nil {
+		cfg = driverConfig(tx.DriverName())
+	}
+	m, err := newMigrator(cfg, source, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	m.tx = tx
+	return m.Run(ctx, migrate)
+}
+
+// openMigrator check the source directory and the options before
+// opening the database of url, the caller must close m.db
+func openMigrator(ctx context.Context, source, url string, opts []Option) (m *Migrator, err error) {
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		return
+	}
+	m, err = newMigrator(cfg, source, opts)
 	if err != nil {
 		return
 	}
-	m := strings.Split(migrate, " ")
-	if len(m) > 2 {
-		err = xerrors.New("the number of migration parameters is incorrect")
+	err = m.open(ctx, url)
+	return
+}
+
+// open connects m to the database of url with the SSL and schema options
+func (m *Migrator) open(ctx context.Context, url string) (err error) {
+	url = socketURL(url)
+	url, err = withSSL(url, m.cfg, m.opts.ssl)
+	if err != nil {
 		return
 	}
-	info, err := os.Stat(source)
+	url, err = withSchema(url, m.cfg, m.opts.schema)
 	if err != nil {
 		return
 	}
-	if !info.IsDir() {
-		err = xerrors.Errorf("%v is not a directory", source)
+	m.db, err = m.connect(ctx, url)
+	return
+}
+
+// connect open the database retrying with exponential backoff
+// up to the ConnectRetries option
+func (m *Migrator) connect(ctx context.Context, url string) (db *sqlx.DB, err error) {
+	backoff := m.opts.connectBackoff
+	for attempt := 1; ; attempt++ {
+		db, err = open(ctx, url, m.cfg)
+		if err == nil {
+			setPool(db, m.opts.pool, m.cfg, url)
+			return
+		}
+		if attempt > m.opts.connectRetries || ctx.Err() != nil {
+			return
+		}
+		m.opts.log.Warn(fmt.Sprintf("database connection failed, retrying in %v: %v", backoff, err), "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("%w: %w", err, ctx.Err())
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// checkSource check that all migration directories exist, when
+// the source can tell, and that there is at least one migration
+func checkSource(vs VersionStrategy, src Source, source string) (err error) {
+	dirs := sourceDirs(source)
+	if len(dirs) == 0 {
+		err = ErrNoDirectory
 		return
 	}
-	err = initSchemaMigrations(ctx, db)
+	if s, ok := src.(statSource); ok {
+		err = checkDirs(s, dirs)
+		if err != nil {
+			return
+		}
+	}
+	up, err := globFiles(vs, src, source, "up")
 	if err != nil {
 		return
 	}
-	switch m[0] {
-	case "up":
-		n, executed, err = doUp(ctx, m, source, db)
-	case "down":
-		n, executed, err = doDown(ctx, m, source, db)
-	case "status":
-		n, executed, err = Status(ctx, source, db)
-	default:
-		err = xerrors.Errorf("unknown migration command")
+	if len(up) == 0 {
+		err = fmt.Errorf("%w in %v", ErrNoMigrationFiles, source)
 	}
 	return
 }
 
+// checkDirs check that all dirs exist and are directories
+func checkDirs(s statSource, dirs []string) error {
+	for _, dir := range dirs {
+		info, err := s.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%v is %w", dir, ErrNotDirectory)
+		}
+	}
+	return nil
+}
+
 // Status check db status
 func Status(ctx context.Context, source string, db *sqlx.DB) (int, []string, error) {
-	n, err := migrationMax(ctx, db)
+	m, err := NewMigrator(db, nil, source)
+	if err != nil {
+		return 0, nil, err
+	}
+	return m.Status(ctx)
+}
+
+func (m *Migrator) status(ctx context.Context) (int, []string, error) {
+	up, err := m.upFiles()
+	if err != nil {
+		return 0, nil, err
+	}
+	err = m.verifyChecksums(ctx, up)
+	if err != nil {
+		return 0, nil, err
+	}
+	return m.unapplied(ctx, up)
+}
+
+// statusFast compares the file versions with the highest recorded
+// version only, the files are not read nor stated, it return the up
+// files newer than the database, the pending versions lower than the
+// recorded one are not reported
+func (m *Migrator) statusFast(ctx context.Context) (int, []string, error) {
+	up, err := m.upFiles()
 	if err != nil {
 		return 0, nil, err
 	}
-	up, err := upFiles(source)
+	current, err := migrationMax(ctx, m.conn(), m.cfg)
 	if err != nil {
 		return 0, nil, err
 	}
-	diff := len(up) - n
-	if diff == 0 {
-		return 0, nil, nil
+	var files []string
+	for _, f := range up {
+		v, err := version(m.opts.strategy, f)
+		if err != nil {
+			return 0, nil, err
+		}
+		if compareVersions(m.opts.strategy, v, current) > 0 {
+			files = append(files, f)
+		}
+	}
+	return len(files), files, nil
+}
+
+// statusMode parse the optional mode of the status action,
+// status fast compares only the highest versions
+func statusMode(args []string) (fast bool, err error) {
+	if len(args) < 2 {
+		return
+	}
+	if args[1] != "fast" {
+		err = ErrInvalidSyntax
+		return
+	}
+	return true, nil
+}
+
+func (m *Migrator) pending(ctx context.Context) (int, []string, error) {
+	up, err := m.upFiles()
+	if err != nil {
+		return 0, nil, err
+	}
+	return m.unapplied(ctx, up)
+}
+
+// unapplied return the up files not recorded in schema_migrations
+func (m *Migrator) unapplied(ctx context.Context, up []string) (int, []string, error) {
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+	files, err := pendingFiles(m.opts.strategy, up, applied)
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(files), files, nil
+}
+
+// pendingFiles return the up files whose version is not in applied
+func pendingFiles(vs VersionStrategy, up []string, applied map[int64]bool) (files []string, err error) {
+	for _, f := range up {
+		var v int64
+		v, err = version(vs, f)
+		if err != nil {
+			return
+		}
+		if !applied[v] {
+			files = append(files, f)
+		}
+	}
+	return
+}
+
+// appliedIndex return how many of the sorted files are up to the
+// last one with a recorded version, the pending files after it are
+// executed by up
+func (m *Migrator) appliedIndex(ctx context.Context, files []string) (int, error) {
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(files); i > 0; i-- {
+		v, err := version(m.opts.strategy, files[i-1])
+		if err != nil {
+			return 0, err
+		}
+		if applied[v] {
+			return i, nil
+		}
+	}
+	return 0, nil
+}
+
+// current return the recorded version and its up file, the file is
+// empty when no migration was executed or the file doesn't exist
+func (m *Migrator) current(ctx context.Context) (v int64, file string, err error) {
+	v, err = migrationMax(ctx, m.conn(), m.cfg)
+	if err != nil || v == 0 {
+		return
+	}
+	up, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	byVersion, err := fileVersions(m.opts.strategy, up)
+	if err != nil {
+		return
+	}
+	file = byVersion[v]
+	return
+}
+
+func (m *Migrator) up(ctx context.Context, n int) (number int, executed []string, err error) {
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	start, err := m.appliedIndex(ctx, files)
+	if err != nil {
+		return
+	}
+	err = m.verifyChecksums(ctx, files)
+	if err != nil {
+		return
+	}
+	err = m.checkOrder(ctx, files, start)
+	if err != nil {
+		return
+	}
+	number, executed, err = m.execUp(ctx, files, start, n)
+	return
+}
+
+// checkOrder fails when migrations before the first current files
+// are pending, up would never execute them, with AllowOutOfOrder it
+// warns, the versions below the lowest recorded one are left by BaselineOnly
+func (m *Migrator) checkOrder(ctx context.Context, files []string, current int) error {
+	versions, err := appliedVersions(ctx, m.conn(), m.cfg)
+	if err != nil || len(versions) == 0 || current == 0 {
+		return err
+	}
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	pending, err := pendingFiles(m.opts.strategy, files[:current], applied)
+	if err != nil {
+		return err
+	}
+	var lower []string
+	for _, f := range pending {
+		v, err := version(m.opts.strategy, f)
+		if err != nil {
+			return err
+		}
+		if compareVersions(m.opts.strategy, v, versions[0]) > 0 {
+			lower = append(lower, f)
+		}
+	}
+	if len(lower) == 0 {
+		return nil
 	}
-	if diff < 0 {
-		diff = -1 * diff
+	last, err := version(m.opts.strategy, files[current-1])
+	if err != nil {
+		return err
 	}
-	return diff, up[len(up)-diff:], nil
+	msg := fmt.Sprintf("%v pending below the recorded version %v, use apply to execute them", strings.Join(lower, ", "), last)
+	if !m.opts.outOfOrder {
+		return fmt.Errorf("%w: %v", ErrOutOfOrder, msg)
+	}
+	m.opts.log.Warn(msg, "files", lower)
+	return nil
 }
 
-func doDown(ctx context.Context, m []string, source string, db *sqlx.DB) (number int, executed []string, err error) {
-	n, err := parsePar(m)
+func (m *Migrator) gotoVersion(ctx context.Context, target int64) (number int, executed []string, err error) {
+	files, err := m.upFiles()
 	if err != nil {
 		return
 	}
-	number, executed, err = down(ctx, source, 0, n, db)
+	idx, err := targetIndex(m.opts.strategy, files, target)
+	if err != nil {
+		return
+	}
+	current, err := m.appliedIndex(ctx, files)
+	if err != nil {
+		return
+	}
+	switch {
+	case idx > current:
+		number, executed, err = m.execUp(ctx, files, current, idx-current)
+	case idx < current:
+		err = m.destructive("goto")
+		if err != nil {
+			return
+		}
+		var applied map[int64]bool
+		applied, err = appliedSet(ctx, m.conn(), m.cfg)
+		if err != nil {
+			return
+		}
+		var above []string
+		above, err = pendingFiles(m.opts.strategy, files[idx:current], applied)
+		if err != nil {
+			return
+		}
+		number, executed, err = m.down(ctx, 0, current-idx-len(above))
+	}
 	return
 }
 
-func doUp(ctx context.Context, m []string, source string, db *sqlx.DB) (number int, executed []string, err error) {
-	n, err := parsePar(m)
+// upTo executes the migrations after the recorded version up to target
+func (m *Migrator) upTo(ctx context.Context, target int64) (number int, executed []string, err error) {
+	files, err := m.upFiles()
 	if err != nil {
 		return
 	}
-	start, err := migrationMax(ctx, db)
+	idx, err := targetIndex(m.opts.strategy, files, target)
 	if err != nil {
 		return
 	}
-	number, executed, err = up(ctx, source, start, n, db)
+	current, err := m.appliedIndex(ctx, files)
+	if err != nil || idx <= current {
+		return
+	}
+	err = m.verifyChecksums(ctx, files)
+	if err != nil {
+		return
+	}
+	number, executed, err = m.execUp(ctx, files, current, idx-current)
 	return
 }
 
-func open(ctx context.Context, url string) (db *sqlx.DB, err error) {
-	db, err = sqlx.ConnectContext(ctx, "postgres", url)
+// upToDate executes the pending migrations with timestamp versions
+// at or before t
+func (m *Migrator) upToDate(ctx context.Context, t time.Time) (number int, executed []string, err error) {
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	target, err := versionAt(m.opts.strategy, files, t)
+	if err != nil || target == 0 {
+		return
+	}
+	return m.upTo(ctx, target)
+}
+
+// applyVersion executes only the migration with the target version,
+// the pending lower versions are reported unless outOfOrder is set
+func (m *Migrator) applyVersion(ctx context.Context, target int64) (number int, executed []string, err error) {
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	idx, err := targetIndex(m.opts.strategy, files, target)
+	if err != nil || idx == 0 {
+		return
+	}
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil || applied[target] {
+		return
+	}
+	lower, err := pendingFiles(m.opts.strategy, files[:idx-1], applied)
 	if err != nil {
-		err = xerrors.Errorf("unable to open db: %v", err)
 		return
 	}
+	if len(lower) > 0 && !m.opts.outOfOrder {
+		err = fmt.Errorf("apply %v: %w: %v", target, ErrOutOfOrder, strings.Join(lower, ", "))
+		return
+	}
+	number, executed, err = m.execUp(ctx, files, idx-1, 1)
+	return
+}
+
+// fileVersions return the files by version
+func fileVersions(vs VersionStrategy, files []string) (byVersion map[int64]string, err error) {
+	byVersion = make(map[int64]string, len(files))
+	for _, f := range files {
+		var v int64
+		v, err = version(vs, f)
+		if err != nil {
+			return
+		}
+		byVersion[v] = f
+	}
+	return
+}
+
+// position return how many of the sorted migration files
+// have a version up to v
+func position(vs VersionStrategy, files []string, v int64) (int, error) {
+	for i, f := range files {
+		fv, err := version(vs, f)
+		if err != nil {
+			return 0, err
+		}
+		if compareVersions(vs, fv, v) > 0 {
+			return i, nil
+		}
+	}
+	return len(files), nil
+}
+
+// targetIndex return how many of the sorted migration files
+// must be executed to reach the target version
+func targetIndex(vs VersionStrategy, files []string, target int64) (int, error) {
+	if target == 0 {
+		return 0, nil
+	}
+	for i, f := range files {
+		v, err := version(vs, f)
+		if err != nil {
+			return 0, err
+		}
+		if v == target {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %v", ErrVersionNotFound, target)
+}
+
+func open(ctx context.Context, url string, cfg *DatabaseConfig) (db *sqlx.DB, err error) {
+	db, err = sqlx.ConnectContext(ctx, cfg.DriverName, cfg.connString(url))
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrOpenDatabase, maskErr(err))
+		return
+	}
+	if cfg.DatabaseType == sqliteConfig.DatabaseType && isMemory(url) {
+		// each connection to an in-memory SQLite has its own database
+		db.SetMaxOpenConns(1)
+	}
 	err = db.PingContext(ctx)
 	if err != nil {
-		err = xerrors.Errorf("error ping db: %v", err)
+		err = fmt.Errorf("%w: %w", ErrPingDatabase, maskErr(err))
 	}
 	return
 }
 
-func insertMigrations(ctx context.Context, n int, tx *sqlx.Tx) (err error) {
-	sql := `INSERT INTO schema_migrations ("version") VALUES ($1)`
-	_, err = tx.ExecContext(ctx, sql, n)
+// insertMigrations records the version and the name of file,
+// errAlreadyApplied is returned when cfg.InsertSQL ignored an
+// already recorded version
+func insertMigrations(ctx context.Context, n int64, file, sum string, tx *sqlx.Tx, cfg *DatabaseConfig) (err error) {
+	tmpl := cfg.InsertSQL
+	if tmpl == "" {
+		tmpl = insertSQL
+	}
+	res, err := tx.ExecContext(ctx, tx.Rebind(cfg.query(tmpl)), n, sum, time.Now().UTC(), migrationName(file))
+	if err != nil {
+		return
+	}
+	rows, rerr := res.RowsAffected()
+	if rerr == nil && rows == 0 {
+		err = errAlreadyApplied
+	}
 	return
 }
 
-func deleteMigrations(ctx context.Context, n int, tx *sqlx.Tx) (err error) {
-	sql := `DELETE FROM schema_migrations WHERE "version"=$1`
+func deleteMigrations(ctx context.Context, n int64, tx *sqlx.Tx, cfg *DatabaseConfig) (err error) {
+	sql := tx.Rebind(cfg.query(`DELETE FROM %[1]s WHERE version = ?`))
 	_, err = tx.ExecContext(ctx, sql, n)
 	return
 }
 
-func schemaMigrationsExists(ctx context.Context, db *sqlx.DB) (b bool, err error) {
-	s := struct {
-		Select int `db:"count"`
-	}{}
-	err = db.GetContext(ctx, &s, "SELECT count(*) FROM information_schema.tables WHERE table_name = 'schema_migrations'")
-	b = s.Select > 0
+func schemaMigrationsExists(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (b bool, err error) {
+	var count int
+	err = sqlx.GetContext(ctx, db, &count, cfg.query(cfg.CheckTableExistsSQL))
+	b = count > 0
 	return
 }
 
-func createMigrationTable(ctx context.Context, db *sqlx.DB) error {
-	sql := `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL, CONSTRAINT schema_migrations_pkey PRIMARY KEY (version))`
-	_, err := db.ExecContext(ctx, sql)
+func createMigrationTable(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) error {
+	_, err := db.ExecContext(ctx, cfg.query(cfg.CreateTableSQL))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func migrationMax(ctx context.Context, db *sqlx.DB) (m int, err error) {
+func migrationCount(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (c int, err error) {
+	if cfg.noTable {
+		return
+	}
+	err = sqlx.GetContext(ctx, db, &c, cfg.query(`SELECT count(*) FROM %[1]s`))
+	return
+}
+
+// appliedMigrations return the executed migrations ordered by version
+func appliedMigrations(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (applied []AppliedMigration, err error) {
+	applied = []AppliedMigration{}
+	if cfg.noTable {
+		return
+	}
+	err = sqlx.SelectContext(ctx, db, &applied, cfg.query(`SELECT version, applied_at, name FROM %[1]s ORDER BY version`))
+	return
+}
+
+// AppliedVersions return the versions recorded in the migrations table
+// in ascending order, if cfg is nil it is chosen by the driver name of db
+func AppliedVersions(ctx context.Context, db *sqlx.DB, cfg *DatabaseConfig) (versions []int64, err error) {
+	if cfg == nil {
+		cfg = driverConfig(db.DriverName())
+	}
+	return appliedVersions(ctx, db, cfg)
+}
+
+func appliedVersions(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (versions []int64, err error) {
+	versions = []int64{}
+	if cfg.noTable {
+		return
+	}
+	err = sqlx.SelectContext(ctx, db, &versions, cfg.query(`SELECT version FROM %[1]s ORDER BY version`))
+	return
+}
+
+// appliedSet return the set of recorded versions
+func appliedSet(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (applied map[int64]bool, err error) {
+	versions, err := appliedVersions(ctx, db, cfg)
+	if err != nil {
+		return
+	}
+	applied = make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return
+}
+
+func migrationMax(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (m int64, err error) {
 	s := struct {
-		Max int `db:"m"`
+		Max int64 `db:"m"`
 	}{}
-	err = db.GetContext(ctx, &s, `SELECT coalesce(max("version"),0) AS m FROM schema_migrations`)
+	if cfg.noTable {
+		return
+	}
+	err = sqlx.GetContext(ctx, db, &s, cfg.query(`SELECT coalesce(max(version), 0) AS m FROM %[1]s`))
 	m = s.Max
 	return
 }
 
-func initSchemaMigrations(ctx context.Context, db *sqlx.DB) (err error) {
+func initSchemaMigrations(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) (err error) {
 	var b bool
-	b, err = schemaMigrationsExists(ctx, db)
+	b, err = schemaMigrationsExists(ctx, db, cfg)
 	if err != nil {
 		return
 	}
 	if !b {
-		err = createMigrationTable(ctx, db)
+		err = createMigrationTable(ctx, db, cfg)
+		return
 	}
+	for _, sql := range cfg.UpgradeTableSQL {
+		_, err = db.ExecContext(ctx, cfg.query(sql))
+		if err != nil && !duplicateColumn(err) {
+			return
+		}
+	}
+	err = checkMigrationTable(ctx, db, cfg)
 	return
 }
+
+// tableColumns are the columns read and written in the migrations table
+var tableColumns = []string{"version", "checksum", "applied_at", "name"}
+
+// duplicateColumn report if err is the SQLite error of a column
+// already added by UpgradeTableSQL
+func duplicateColumn(err error) bool {
+	return strings.Contains(err.Error(), "duplicate column name")
+}
+
+// checkMigrationTable check that an existing migrations table has the
+// expected columns, a table of another tool with the same name fails
+// with a clear error instead of failing when recording a migration
+func checkMigrationTable(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) error {
+	rows, err := db.QueryxContext(ctx, cfg.query(`SELECT * FROM %[1]s WHERE 1 = 0`))
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // nolint
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		found[strings.ToLower(c)] = true
+	}
+	var missing []string
+	for _, c := range tableColumns {
+		if !found[c] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %v has no %v column, it may belong to another migration tool, use another table with -table or the TableName option",
+			ErrIncompatibleTable, cfg.TableName, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -1,12 +1,24 @@
 package migration
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	// pq driver for tests
 	_ "github.com/lib/pq"
+	// sqlite driver for tests
+	_ "modernc.org/sqlite"
 )
 
 func Test_upFiles(t *testing.T) {
@@ -28,7 +40,7 @@ func Test_upFiles(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotFiles, err := upFiles(tt.path)
+			gotFiles, err := upFiles(SequentialStrategy{}, FSSource(osFS{}), tt.path)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("upFiles() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -46,20 +58,34 @@ func Test_downFiles(t *testing.T) {
 		wantFiles []string
 		wantErr   bool
 		path      string
+		applied   []int64
 	}{
 		{
-			name: "list files",
-			path: "testdata",
+			name:    "list files",
+			path:    "testdata",
+			applied: []int64{1, 2, 3},
 			wantFiles: []string{
 				"testdata/003_a_name.down.sql",
 				"testdata/002_b_name.down.sql",
 				"testdata/001_name.down.sql",
 			},
 		},
+		{
+			name:    "empty dir",
+			path:    t.TempDir(),
+			applied: []int64{1, 2},
+			wantErr: true,
+		},
+		{
+			name:    "fewer files than requested",
+			path:    "testdata",
+			applied: []int64{1, 2, 3, 4},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotFiles, err := downFiles(tt.path, 3)
+			gotFiles, err := downFiles(SequentialStrategy{}, FSSource(osFS{}), tt.path, tt.applied)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("downFiles() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -71,6 +97,157 @@ func Test_downFiles(t *testing.T) {
 	}
 }
 
+func Test_downFilesMissing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/001_a.up.sql":   {},
+		"m/001_a.down.sql": {},
+		"m/002_b.up.sql":   {},
+		"m/003_c.up.sql":   {},
+		"m/003_c.down.sql": {},
+	}
+	files, err := downFiles(SequentialStrategy{}, FSSource(fsys), "m", []int64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"m/001_a.down.sql"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("downFiles() = %v, want %v", files, want)
+	}
+	_, err = downFiles(SequentialStrategy{}, FSSource(fsys), "m", []int64{1, 2, 3})
+	if !errors.Is(err, ErrMissingDownFile) {
+		t.Errorf("expected ErrMissingDownFile but got %v", err)
+	}
+	_, err = downFiles(SequentialStrategy{}, FSSource(fsys), "m", []int64{1, 2, 3, 4})
+	if !errors.Is(err, ErrMissingUpFile) {
+		t.Errorf("expected ErrMissingUpFile but got %v", err)
+	}
+}
+
+func Test_globFilesMultipleDirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"billing/001_invoice.up.sql": {},
+		"billing/003_payment.up.sql": {},
+		"auth/002_user.up.sql":       {},
+		"auth/010_role.up.sql":       {},
+	}
+	files, err := upFiles(SequentialStrategy{}, FSSource(fsys), "billing, auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"billing/001_invoice.up.sql",
+		"auth/002_user.up.sql",
+		"billing/003_payment.up.sql",
+		"auth/010_role.up.sql",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("upFiles() = %v, want %v", files, want)
+	}
+	fsys["auth/003_session.up.sql"] = &fstest.MapFile{}
+	_, err = upFiles(SequentialStrategy{}, FSSource(fsys), "billing,auth")
+	if err == nil {
+		t.Error("expected duplicate version error")
+	}
+}
+
+func Test_execUpDryRun(t *testing.T) {
+	files := []string{
+		"testdata/001_name.up.sql",
+		"testdata/002_b_name.up.sql",
+		"testdata/003_a_name.up.sql",
+	}
+	var buf bytes.Buffer
+	m, err := newMigrator(&postgresConfig, "testdata", []Option{DryRun(&buf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, executed, err := m.execUp(context.Background(), files, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected n %v but got %v", 2, n)
+	}
+	if !reflect.DeepEqual(executed, files[1:]) {
+		t.Errorf("expected executed %v but got %v", files[1:], executed)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"-- testdata/002_b_name.up.sql",
+		`ALTER TABLE "test" ADD COLUMN "int" Integer;`,
+		"-- insert schema_migrations version 2",
+		"-- insert schema_migrations version 3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got %q", want, out)
+		}
+	}
+	if strings.Contains(out, "001_name.up.sql") {
+		t.Errorf("expected output without the already executed migration, got %q", out)
+	}
+}
+
+func Test_execUpFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	files, err := upFiles(SequentialStrategy{}, FSSource(fsys), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql"}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("upFiles() = %v, want %v", files, want)
+	}
+	var buf bytes.Buffer
+	m, err := newMigrator(&postgresConfig, "migrations", []Option{WithFS(fsys), DryRun(&buf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := m.execUp(context.Background(), files, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected n %v but got %v", 2, n)
+	}
+	if !strings.Contains(buf.String(), "CREATE TABLE b (id int);") {
+		t.Errorf("expected output to contain the migration read from fs, got %q", buf.String())
+	}
+}
+
+func TestRunDryRunWritesNothing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	for _, action := range []string{"up", "status", "baseline 1", "force 1", "down"} {
+		var out bytes.Buffer
+		_, _, err := Run(ctx, "migrations", url, action, WithFS(fsys), DryRun(&out))
+		if err != nil {
+			t.Fatalf("%v: %v", action, err)
+		}
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tables []string
+	err = db.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("expected no tables after the dry runs but got %v", tables)
+	}
+}
+
 func TestRun(t *testing.T) {
 	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
 	source := "./testdata"
@@ -127,3 +304,1045 @@ func TestRun(t *testing.T) {
 		t.Error("err is nil")
 	}
 }
+
+func Test_pendingFiles(t *testing.T) {
+	up := []string{
+		"testdata/001_name.up.sql",
+		"testdata/002_b_name.up.sql",
+		"testdata/003_a_name.up.sql",
+	}
+	tests := []struct {
+		name    string
+		applied map[int64]bool
+		want    []string
+	}{
+		{name: "none applied", applied: map[int64]bool{}, want: up},
+		{name: "all applied", applied: map[int64]bool{1: true, 2: true, 3: true}, want: nil},
+		{name: "gap", applied: map[int64]bool{2: true}, want: []string{up[0], up[2]}},
+		{name: "hole", applied: map[int64]bool{1: true, 3: true}, want: []string{up[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pendingFiles(SequentialStrategy{}, up, tt.applied)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPending(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	_, _, err := Run(context.Background(), source, url, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DELETE FROM schema_migrations`) // nolint
+	n, pending, err := Run(context.Background(), source, url, "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"testdata/001_name.up.sql", "testdata/003_a_name.up.sql"}
+	if n != 2 || !reflect.DeepEqual(pending, want) {
+		t.Errorf("expected pending %v but got %v %v", want, n, pending)
+	}
+}
+
+func TestRunStatusHoles(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	_, _, err := Run(context.Background(), source, url, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Run(context.Background(), source, url, "down") // nolint
+	db, err := sqlx.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`DELETE FROM schema_migrations WHERE version = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`INSERT INTO schema_migrations (version) VALUES (2)`) // nolint
+	n, pending, err := Run(context.Background(), source, url, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"testdata/002_b_name.up.sql"}
+	if n != 1 || !reflect.DeepEqual(pending, want) {
+		t.Errorf("expected pending %v but got %v %v", want, n, pending)
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	v, files, err := Run(context.Background(), source, url, "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0 || len(files) != 0 {
+		t.Errorf("expected version 0 without file but got %v %v", v, files)
+	}
+	_, _, err = Run(context.Background(), source, url, "up 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Run(context.Background(), source, url, "down") // nolint
+	v, files, err = Run(context.Background(), source, url, "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"testdata/002_b_name.up.sql"}
+	if v != 2 || !reflect.DeepEqual(files, want) {
+		t.Errorf("expected version 2 %v but got %v %v", want, v, files)
+	}
+}
+
+func Test_targetIndex(t *testing.T) {
+	files := []string{
+		"testdata/001_name.up.sql",
+		"testdata/002_b_name.up.sql",
+		"testdata/003_a_name.up.sql",
+	}
+	tests := []struct {
+		name    string
+		target  int64
+		want    int
+		wantErr bool
+	}{
+		{name: "first", target: 1, want: 1},
+		{name: "last", target: 3, want: 3},
+		{name: "all down", target: 0, want: 0},
+		{name: "missing file", target: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := targetIndex(SequentialStrategy{}, files, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("targetIndex() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("targetIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunGoto(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	tests := []struct {
+		action string
+		want   int
+	}{
+		{action: "goto 2", want: 2},
+		{action: "goto 2", want: 0},
+		{action: "goto 3", want: 1},
+		{action: "goto 1", want: 2},
+		{action: "goto 0", want: 1},
+	}
+	for _, tt := range tests {
+		n, _, err := Run(context.Background(), source, url, tt.action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("%v: expected n %v but got %v", tt.action, tt.want, n)
+		}
+	}
+	_, _, err := Run(context.Background(), source, url, "goto 9")
+	if err == nil {
+		t.Error("expected error for a version without migration file")
+	}
+}
+
+func TestForce(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	before, after, err := Force(context.Background(), source, url, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != 0 || after != 2 {
+		t.Errorf("expected version from 0 to 2 but got from %v to %v", before, after)
+	}
+	n, _, err := Run(context.Background(), source, url, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 pending migration but got %v", n)
+	}
+	_, _, err = Force(context.Background(), source, url, 7)
+	if err == nil {
+		t.Error("expected error forcing a version without migration file")
+	}
+	before, after, err = Force(context.Background(), source, url, 7, AllowMissing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != 2 || after != 7 {
+		t.Errorf("expected version from 2 to 7 but got from %v to %v", before, after)
+	}
+	_, after, err = Force(context.Background(), source, url, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != 0 {
+		t.Errorf("expected version 0 but got %v", after)
+	}
+}
+
+func TestForceRecordsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/002_b.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	_, _, err := Force(ctx, "migrations", url, 2, WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var rows []struct {
+		Version   int64      `db:"version"`
+		Checksum  *string    `db:"checksum"`
+		AppliedAt *time.Time `db:"applied_at"`
+		Name      *string    `db:"name"`
+	}
+	err = db.Select(&rows, "SELECT version, checksum, applied_at, name FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %v rows but got %+v", len(want), rows)
+	}
+	for i, r := range rows {
+		if r.Checksum == nil || *r.Checksum != checksum(fsys[fmt.Sprintf("migrations/%03d_%v.up.sql", i+1, want[i])].Data) {
+			t.Errorf("expected the checksum of the file for version %v", r.Version)
+		}
+		if r.AppliedAt == nil || r.Name == nil || *r.Name != want[i] {
+			t.Errorf("expected the name %v and applied_at recorded for version %v", want[i], r.Version)
+		}
+	}
+	_, _, err = Run(ctx, "migrations", url, "verify", WithFS(fsys))
+	if err != nil {
+		t.Errorf("expected the forced versions verified but got %v", err)
+	}
+}
+
+func TestRunOnApplied(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	durations := map[string]time.Duration{}
+	onApplied := OnApplied(func(file string, d time.Duration) {
+		durations[file] = d
+	})
+	url := fakesqlURL(t)
+	_, executed, err := Run(context.Background(), "migrations", url, "up", WithFS(fsys), onApplied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(durations) != len(executed) {
+		t.Fatalf("expected %v durations but got %v", len(executed), durations)
+	}
+	for _, f := range executed {
+		d, ok := durations[f]
+		if !ok || d < 0 {
+			t.Errorf("expected a non-negative duration for %v but got %v", f, d)
+		}
+	}
+}
+
+func TestRunProtectDestructive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	opts := []Option{WithFS(fsys), ProtectDestructive()}
+	n, _, err := Run(ctx, "migrations", url, "up", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 migrations executed but got %v", n)
+	}
+	for _, action := range []string{"down", "goto 1", "force 1"} {
+		_, _, err = Run(ctx, "migrations", url, action, opts...)
+		if !errors.Is(err, ErrDestructiveAction) {
+			t.Errorf("expected %v to require confirmation but got %v", action, err)
+		}
+	}
+	_, _, err = Run(ctx, "migrations", url, "status", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err = Run(ctx, "migrations", url, "goto 1", append(opts, ConfirmDestructive())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 migration reverted but got %v", n)
+	}
+	t.Setenv("MIGRATION_ALLOW_DESTRUCTIVE", "1")
+	n, _, err = Run(ctx, "migrations", url, "down", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 migration reverted but got %v", n)
+	}
+}
+
+func TestAppliedVersions(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	cfg := sqliteConfig
+	err = initSchemaMigrations(ctx, db, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := AppliedVersions(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions == nil || len(versions) != 0 {
+		t.Errorf("expected an empty slice but got %#v", versions)
+	}
+	for _, v := range []int64{5, 1, 3} {
+		_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err = AppliedVersions(ctx, db, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 3, 5}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected %v but got %v", want, versions)
+	}
+}
+
+func Test_execDownMissing(t *testing.T) {
+	files := []string{
+		"testdata/002_b_name.down.sql",
+		"testdata/001_name.down.sql",
+	}
+	m, err := newMigrator(&postgresConfig, "testdata", []Option{DryRun(io.Discard)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := m.execDown(context.Background(), files, 0, 3)
+	if !errors.Is(err, ErrMissingDownFile) {
+		t.Errorf("expected ErrMissingDownFile but got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no migration reverted but got %v", n)
+	}
+}
+
+func TestExecUpAlreadyApplied(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := NewMigrator(db, nil, "migrations", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = initSchemaMigrations(ctx, db, m.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := m.upFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both runs see the same pending files, as two runs without lock
+	n, executed, err := m.execUp(ctx, files, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(executed) != 2 {
+		t.Fatalf("expected 2 migrations executed but got %v %v", n, executed)
+	}
+	n, executed, err = m.execUp(ctx, files, 0, 0)
+	if err != nil {
+		t.Fatalf("expected the recorded versions to be skipped but got %v", err)
+	}
+	if n != 0 || len(executed) != 0 {
+		t.Errorf("expected 0 migrations executed but got %v %v", n, executed)
+	}
+}
+
+func TestRunUpToAndApply(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, executed, err := Run(ctx, "migrations", url, "up-to 2", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql"}; n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	n, _, err = Run(ctx, "migrations", url, "up-to 1", WithFS(fsys))
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to execute up to an applied version but got %v %v", n, err)
+	}
+
+	url = "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err = Run(ctx, "migrations", url, "apply 3", WithFS(fsys))
+	if !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("expected ErrOutOfOrder but got %v", err)
+	}
+	n, executed, err = Run(ctx, "migrations", url, "apply 3", WithFS(fsys), AllowOutOfOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/003_c.up.sql"}; n != 1 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	n, executed, err = Run(ctx, "migrations", url, "apply 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/001_a.up.sql"}; n != 1 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 3}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected the versions %v recorded but got %v", want, versions)
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+		"migrations/004_d.up.sql":   {Data: []byte("CREATE TABLE d (id int);")},
+		"migrations/004_d.down.sql": {Data: []byte("DROP TABLE d;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "run 002_b.up.sql 005_e.up.sql", WithFS(fsys))
+	if !errors.Is(err, ErrMissingUpFile) {
+		t.Fatalf("expected ErrMissingUpFile but got %v", err)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "run 004_d.up.sql migrations/002_b.up.sql", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/004_d.up.sql", "migrations/002_b.up.sql"}; n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed in order but got %v %v", want, n, executed)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{2, 4}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected the versions %v recorded but got %v", want, versions)
+	}
+	n, _, err = Run(ctx, "migrations", url, "run 002_b.up.sql", WithFS(fsys))
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to execute for an applied file but got %v %v", n, err)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	// the hook runs in the migration transaction, as a Ctrl-C in the middle of it
+	interrupt := BeforeAll(func(context.Context, *sqlx.Tx) error {
+		cancel()
+		return nil
+	})
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), interrupt)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no migration executed but got %v", n)
+	}
+	versions, err := appliedVersionsOf(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("expected the transaction rolled back but got the versions %v", versions)
+	}
+}
+
+func TestRunOutOfOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/004_d.up.sql":   {Data: []byte("CREATE TABLE d (id int);")},
+		"migrations/004_d.down.sql": {Data: []byte("DROP TABLE d;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 003 merged later from another branch, after 004 was executed
+	fsys["migrations/003_c.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id int);")}
+	fsys["migrations/003_c.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE c;")}
+	fsys["migrations/005_e.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE e (id int);")}
+	fsys["migrations/005_e.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE e;")}
+	db, err := sqlx.Open("sqlite", strings.TrimPrefix(url, "sqlite://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the position counter recorded 1, 2 and 3 for 001, 002 and 004
+	_, err = db.Exec(`UPDATE schema_migrations SET version = 4 WHERE version = 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if !errors.Is(err, ErrOutOfOrder) || !strings.Contains(err.Error(), "003_c.up.sql") {
+		t.Fatalf("expected the pending 003 to be detected but got %v", err)
+	}
+	var log recordLogger
+	n, executed, err := Run(ctx, "migrations", url, "up", WithFS(fsys), AllowOutOfOrder(), WithLogger(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/005_e.up.sql"}; n != 1 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	if !strings.HasPrefix(log.lines[0], "warn") || !strings.Contains(log.lines[0], "003_c.up.sql") {
+		t.Errorf("expected a warning about 003 but got %v", log.lines)
+	}
+}
+
+func TestRunFake(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, executed, err := Run(ctx, "migrations", url, "up", WithFS(fsys), Fake())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql"}
+	if n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v marked but got %v %v", want, n, executed)
+	}
+	db, err := sqlx.Open("sqlite", strings.TrimPrefix(url, "sqlite://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tables int
+	err = db.Get(&tables, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name IN ('a', 'b')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("expected no table created but got %v", tables)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []int64{1, 2}) {
+		t.Errorf("expected versions [1 2] recorded but got %v", versions)
+	}
+}
+
+func TestRunActions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"001_a.up.sql":   "CREATE TABLE a (id int);",
+		"001_a.down.sql": "DROP TABLE a;",
+		"002_b.up.sql":   "CREATE TABLE b (id int);",
+		"002_b.down.sql": "DROP TABLE b;",
+	}
+	for name, sql := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	n, executed, err := RunActions(ctx, dir, db, nil, "up", "down 1", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "001_a.up.sql"),
+		filepath.Join(dir, "002_b.up.sql"),
+		filepath.Join(dir, "002_b.down.sql"),
+		filepath.Join(dir, "002_b.up.sql"),
+	}
+	if n != 4 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	versions, err := AppliedVersions(ctx, db, driverConfig("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []int64{1, 2}) {
+		t.Errorf("expected versions [1 2] recorded but got %v", versions)
+	}
+	n, _, err = RunActions(ctx, dir, db, nil, "down 1", "goto")
+	if !errors.Is(err, ErrMissingVersion) || n != 1 {
+		t.Errorf("expected to stop at goto after 1 migration but got %v %v", n, err)
+	}
+}
+
+func TestRunWithTx(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := RunWithTx(ctx, "migrations", tx, nil, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 migrations executed but got %v", n)
+	}
+	var versions []int64
+	err = tx.Select(&versions, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []int64{1, 2}) {
+		t.Errorf("expected versions [1 2] in the transaction but got %v", versions)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables int
+	err = db.Get(&tables, `SELECT count(*) FROM sqlite_master WHERE type = 'table'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("expected nothing persisted after the rollback but got %v tables", tables)
+	}
+}
+
+func TestRunBOM(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("\xEF\xBB\xBF-- migration:timeout=5s\nCREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("\xEF\xBB\xBFDROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (name text DEFAULT 'caf\xe9');")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	var (
+		log     recordLogger
+		verbose bytes.Buffer
+	)
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), WithLogger(&log), Verbose(&verbose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 migrations executed but got %v", n)
+	}
+	if bytes.Contains(verbose.Bytes(), utf8BOM) {
+		t.Errorf("expected the BOM removed before executing but got %q", verbose.String())
+	}
+	var warned bool
+	for _, l := range log.lines {
+		warned = warned || strings.Contains(l, "002_b.up.sql is not valid UTF-8")
+	}
+	if !warned {
+		t.Errorf("expected an invalid UTF-8 warning but got %v", log.lines)
+	}
+	n, _, err = Run(ctx, "migrations", url, "down", WithFS(fsys))
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 migrations reverted but got %v %v", n, err)
+	}
+}
+
+func TestRunTag(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_billing_invoices.up.sql":   {Data: []byte("CREATE TABLE invoices (id int);")},
+		"migrations/001_billing_invoices.down.sql": {Data: []byte("DROP TABLE invoices;")},
+		"migrations/002_auth_users.up.sql":         {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/002_auth_users.down.sql":       {Data: []byte("DROP TABLE users;")},
+		"migrations/003_billing_payments.up.sql":   {Data: []byte("CREATE TABLE payments (id int);")},
+		"migrations/003_billing_payments.down.sql": {Data: []byte("DROP TABLE payments;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, executed, err := Run(ctx, "migrations", url, "up", WithFS(fsys), Tag("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/001_billing_invoices.up.sql", "migrations/003_billing_payments.up.sql"}
+	if n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	list, err := List(ctx, "migrations", url, WithFS(fsys), Tag("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || !list[0].Applied || !list[1].Applied {
+		t.Errorf("expected the 2 billing migrations applied but got %+v", list)
+	}
+	_, executed, err = Run(ctx, "migrations", url, "down", WithFS(fsys), Tag("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"migrations/003_billing_payments.down.sql", "migrations/001_billing_invoices.down.sql"}
+	if !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v", want, executed)
+	}
+}
+
+func TestRunTagSharedTable(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_billing_invoices.up.sql": {Data: []byte("CREATE TABLE invoices (id int);")},
+		"migrations/002_auth_users.up.sql":       {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/003_billing_payments.up.sql": {Data: []byte("CREATE TABLE payments (id int);")},
+		"migrations/004_auth_roles.up.sql":       {Data: []byte("CREATE TABLE roles (id int);")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	for _, tag := range []string{"billing", "auth"} {
+		_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), Tag(tag))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := Force(ctx, "migrations", url, 1, WithFS(fsys), Tag("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 4}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected force to keep the auth versions %v but got %v", want, versions)
+	}
+	_, _, err = Run(ctx, "migrations", url, "baseline 3", WithFS(fsys), Tag("billing"), ForceBaseline())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err = appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 3, 4}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected baseline to keep the auth versions %v but got %v", want, versions)
+	}
+}
+
+func TestRunTagOtherVersions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_auth_users.up.sql":         {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/002_auth_roles.up.sql":         {Data: []byte("CREATE TABLE roles (id int);")},
+		"migrations/003_billing_invoices.up.sql":   {Data: []byte("CREATE TABLE invoices (id int);")},
+		"migrations/003_billing_invoices.down.sql": {Data: []byte("DROP TABLE invoices;")},
+		"migrations/004_billing_payments.up.sql":   {Data: []byte("CREATE TABLE payments (id int);")},
+		"migrations/004_billing_payments.down.sql": {Data: []byte("DROP TABLE payments;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	// the auth versions 1 and 2 are the positions of the billing files
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), Tag("auth"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), Tag("billing"))
+	if err != nil || n != 2 {
+		t.Fatalf("expected the 2 billing migrations executed but got %v %v", n, err)
+	}
+	n, _, err = Run(ctx, "migrations", url, "down", WithFS(fsys), Tag("billing"))
+	if err != nil || n != 2 {
+		t.Fatalf("expected the 2 billing migrations reverted but got %v %v", n, err)
+	}
+	_, _, err = Force(ctx, "migrations", url, 4, WithFS(fsys), Tag("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 3, 4}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected the auth versions kept in %v but got %v", want, versions)
+	}
+}
+
+func TestRunNonContiguousVersions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/005_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/005_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/010_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/010_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := appliedVersionsOf(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 5, 10}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("expected the versions %v recorded but got %v", want, versions)
+	}
+	_, executed, err := Run(ctx, "migrations", url, "down 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/010_c.down.sql"}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v", want, executed)
+	}
+	v, files, err := Run(ctx, "migrations", url, "version", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/005_b.up.sql"}; v != 5 || !reflect.DeepEqual(files, want) {
+		t.Errorf("expected version 5 %v but got %v %v", want, v, files)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "goto 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/005_b.down.sql"}; n != 1 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+}
+
+func TestRunDownMoreThanApplied(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "down 10", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/003_c.down.sql", "migrations/002_b.down.sql", "migrations/001_a.down.sql"}
+	if n != 3 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v reverted but got %v %v", want, n, executed)
+	}
+	n, _, err = Run(ctx, "migrations", url, "down 10", WithFS(fsys))
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to revert but got %v %v", n, err)
+	}
+}
+
+func TestRunStatusFast(t *testing.T) {
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/002_b.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/003_c.up.sql": {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/004_d.up.sql": {Data: []byte("CREATE TABLE d (id int);")},
+	}
+	n, files, err := Run(ctx, "migrations", url, "status fast", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || len(files) != 4 {
+		t.Errorf("expected the 4 files newer than an empty database but got %v %v", n, files)
+	}
+	_, _, err = Run(ctx, "migrations", url, "up 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "apply 3", WithFS(fsys), AllowOutOfOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the hole of version 2 is only reported by the full status
+	n, files, err = Run(ctx, "migrations", url, "status fast", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/004_d.up.sql"}; n != 1 || !reflect.DeepEqual(files, want) {
+		t.Errorf("expected the gap %v but got %v %v", want, n, files)
+	}
+	n, _, err = Run(ctx, "migrations", url, "status", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 pending migrations with the full status but got %v", n)
+	}
+	_, _, err = Run(ctx, "migrations", url, "status slow", WithFS(fsys))
+	if !errors.Is(err, ErrInvalidSyntax) {
+		t.Errorf("expected ErrInvalidSyntax but got %v", err)
+	}
+}
+
+func BenchmarkStatus(b *testing.B) {
+	ctx := context.Background()
+	dir := b.TempDir()
+	const files = 500
+	for i := 1; i <= files; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%04d_table_%v.up.sql", i, i))
+		err := os.WriteFile(name, []byte(fmt.Sprintf("CREATE TABLE t%v (id int);", i)), 0o600)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	url := "sqlite://" + filepath.Join(b.TempDir(), "test.db")
+	_, _, err := Run(ctx, dir, url, fmt.Sprintf("up %v", files-10))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, action := range []string{"status", "status fast"} {
+		b.Run(action, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				n, _, err := Run(ctx, dir, url, action)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != 10 {
+					b.Fatalf("expected 10 pending migrations but got %v", n)
+				}
+			}
+		})
+	}
+}
+
+func TestRunUpCount(t *testing.T) {
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/002_b.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/003_c.up.sql": {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/004_d.up.sql": {Data: []byte("CREATE TABLE d (id int);")},
+	}
+	tests := []struct {
+		action string
+		want   []string
+	}{
+		{action: "up 1", want: []string{"migrations/001_a.up.sql"}},
+		{action: "up 2", want: []string{"migrations/002_b.up.sql", "migrations/003_c.up.sql"}},
+		{action: "up 5", want: []string{"migrations/004_d.up.sql"}},
+		{action: "up 1", want: nil},
+	}
+	for _, tt := range tests {
+		n, executed, err := Run(ctx, "migrations", url, tt.action, WithFS(fsys))
+		if err != nil {
+			t.Fatalf("%v: %v", tt.action, err)
+		}
+		if n != len(tt.want) || !reflect.DeepEqual(executed, tt.want) {
+			t.Errorf("%v: expected %v but got %v %v", tt.action, tt.want, n, executed)
+		}
+	}
+	_, _, err := Run(ctx, "migrations", url, "up -1", WithFS(fsys))
+	if !errors.Is(err, ErrInvalidSyntax) {
+		t.Errorf("expected ErrInvalidSyntax for a negative count but got %v", err)
+	}
+}
@@ -0,0 +1,463 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migrator performs the migrations of source in an open database,
+// it holds the configuration that Run receives as arguments
+type Migrator struct {
+	db     *sqlx.DB
+	tx     *sqlx.Tx
+	cfg    *DatabaseConfig
+	source string
+	opts   *options
+	// checked is set after the first action that reads the source
+	checked bool
+}
+
+// NewMigrator return a Migrator for the migrations of source in db,
+// if cfg is nil it is chosen by the driver name of db
+func NewMigrator(db *sqlx.DB, cfg *DatabaseConfig, source string, opts ...Option) (m *Migrator, err error) {
+	if cfg == nil {
+		cfg = driverConfig(db.DriverName())
+	}
+	m, err = newMigrator(cfg, source, opts)
+	if err != nil {
+		return
+	}
+	m.db = db
+	return
+}
+
+// newMigrator check the options, the returned Migrator has its own
+// copy of cfg and no database, the source directory is checked by
+// the first action that reads the migration files
+func newMigrator(cfg *DatabaseConfig, source string, opts []Option) (m *Migrator, err error) {
+	m, err = configure(cfg, opts)
+	if err != nil {
+		return
+	}
+	m.source = source
+	return
+}
+
+// checkSource check the source directory once, before the lock is
+// taken by the actions that read the migration files
+func (m *Migrator) checkSource() error {
+	if m.checked {
+		return nil
+	}
+	err := checkSource(m.opts.strategy, m.opts.src, m.source)
+	if err != nil {
+		return err
+	}
+	m.checked = true
+	return nil
+}
+
+// configure check the options, the returned Migrator has its own
+// copy of cfg, no source and no database
+func configure(cfg *DatabaseConfig, opts []Option) (m *Migrator, err error) {
+	o := newOptions(opts)
+	c := *cfg
+	if o.table != "" {
+		if !validIdentifier(o.table) {
+			err = fmt.Errorf("%w %q", ErrInvalidTableName, o.table)
+			return
+		}
+		c.TableName = o.table
+	}
+	if o.schema != "" {
+		if !validIdentifier(o.schema) {
+			err = fmt.Errorf("%w %q", ErrInvalidSchemaName, o.schema)
+			return
+		}
+		if c.postgres() && c.CheckTableExistsSQL == checkTableExistsSQL {
+			c.CheckTableExistsSQL = checkTableExistsSQL + ` AND table_schema = current_schema()`
+		}
+	}
+	if o.retries >= 0 {
+		c.Retries = o.retries
+	}
+	m = &Migrator{
+		cfg:  &c,
+		opts: o,
+	}
+	return
+}
+
+// destructive check if the action that reverts or deletes
+// recorded migrations is allowed, dry runs are always allowed
+func (m *Migrator) destructive(action string) error {
+	if !m.opts.protect || m.opts.confirm || m.opts.dryRun != nil || os.Getenv("MIGRATION_ALLOW_DESTRUCTIVE") == "1" {
+		return nil
+	}
+	return fmt.Errorf("%v %w, use -confirm or set MIGRATION_ALLOW_DESTRUCTIVE=1", action, ErrDestructiveAction)
+}
+
+// begin check the source directory, acquire the migration lock and
+// create the schema_migrations table if needed, unlock releases the
+// lock, a dry run takes no lock and writes nothing
+func (m *Migrator) begin(ctx context.Context) (unlock func(), err error) {
+	unlock = func() {}
+	err = m.checkSource()
+	if err != nil {
+		return
+	}
+	return m.beginWithoutSource(ctx)
+}
+
+// beginWithoutSource is begin for the actions that don't read the
+// migration files, e.g. version and seed work with an empty directory
+func (m *Migrator) beginWithoutSource(ctx context.Context) (unlock func(), err error) {
+	unlock = func() {}
+	if m.opts.dryRun != nil {
+		err = m.dryRunTable(ctx)
+		return
+	}
+	err = checkWritable(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	if m.tx == nil {
+		unlock, err = lock(ctx, m.db, m.cfg, m.opts.lockTimeout, m.opts.lockTTL)
+		if err != nil {
+			return
+		}
+	}
+	err = initSchemaMigrations(ctx, m.conn(), m.cfg)
+	if err != nil {
+		unlock()
+	}
+	return
+}
+
+// dryRunTable check the migrations table without creating or
+// upgrading it, a missing table is read as empty
+func (m *Migrator) dryRunTable(ctx context.Context) error {
+	exists, err := schemaMigrationsExists(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return err
+	}
+	m.cfg.noTable = !exists
+	if !exists {
+		return nil
+	}
+	err = checkMigrationTable(ctx, m.conn(), m.cfg)
+	if errors.Is(err, ErrIncompatibleTable) && len(m.cfg.UpgradeTableSQL) > 0 {
+		err = fmt.Errorf("%w, or run once without the dry run to upgrade an old table", err)
+	}
+	return err
+}
+
+// checkWritable fails with ErrReadOnly when the database can't
+// write, the migrations would fail or be lost on a replica
+func checkWritable(ctx context.Context, db sqlx.ExtContext, cfg *DatabaseConfig) error {
+	if cfg.ReadOnlySQL == "" {
+		return nil
+	}
+	var readOnly bool
+	err := sqlx.GetContext(ctx, db, &readOnly, cfg.ReadOnlySQL)
+	if err != nil {
+		return fmt.Errorf("read-only check: %w", err)
+	}
+	if readOnly {
+		return fmt.Errorf("%w: %v", ErrReadOnly, cfg.DatabaseType)
+	}
+	return nil
+}
+
+// conn return the transaction of RunWithTx or the database
+func (m *Migrator) conn() sqlx.ExtContext {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.db
+}
+
+// beginTx begins a migration transaction, with RunWithTx it is the
+// transaction of the caller
+func (m *Migrator) beginTx(ctx context.Context) (*sqlx.Tx, error) {
+	if m.tx != nil {
+		return m.tx, nil
+	}
+	return m.db.BeginTxx(ctx, nil)
+}
+
+// commit commits tx unless it is the transaction of the caller
+func (m *Migrator) commit(tx *sqlx.Tx) error {
+	if tx == m.tx {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// rollback rolls tx back unless it is the transaction of the caller
+func (m *Migrator) rollback(tx *sqlx.Tx) {
+	if tx == m.tx {
+		return
+	}
+	tx.Rollback() // nolint
+}
+
+// locked runs fn holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func() (int, []string, error)) (int, []string, error) {
+	unlock, err := m.begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+	return fn()
+}
+
+// lockedWithoutSource is locked for the actions that don't read the
+// migration files
+func (m *Migrator) lockedWithoutSource(ctx context.Context, fn func() (int, []string, error)) (int, []string, error) {
+	unlock, err := m.beginWithoutSource(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+	return fn()
+}
+
+// Run parse and performs the required migration
+func (m *Migrator) Run(ctx context.Context, migrate string) (int, []string, error) {
+	args, err := parseAction(migrate)
+	if err != nil {
+		return 0, nil, err
+	}
+	var (
+		n    int
+		v    int64
+		date time.Time
+	)
+	switch args[0] {
+	case "up-to-date":
+		if len(args) != 2 {
+			err = fmt.Errorf("%v requires the target date", args[0])
+			break
+		}
+		date, err = parseDate(args[1])
+	case "up", "down":
+		n, err = parsePar(args)
+	case "goto", "force", "up-to", "apply", "baseline":
+		v, err = requiredPar(args, args[0])
+	case "history":
+		_, err = historyOrder(args)
+	case "status":
+		_, err = statusMode(args)
+	case "run":
+		if len(args) < 2 {
+			err = fmt.Errorf("%v requires the migration files", args[0])
+		}
+	case "pending", "version", "seed", "verify", "list", "plan", "unlock":
+	default:
+		err = ErrUnknownAction
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if args[0] == "unlock" {
+		// the lock can't be taken to release it
+		return 0, nil, m.forceUnlock(ctx)
+	}
+	locked := m.locked
+	if args[0] == "version" || args[0] == "seed" {
+		// they work with an empty migrations directory
+		locked = m.lockedWithoutSource
+	}
+	return locked(ctx, func() (int, []string, error) {
+		switch args[0] {
+		case "up":
+			return m.up(ctx, n)
+		case "down":
+			return m.down(ctx, 0, n)
+		case "goto":
+			return m.gotoVersion(ctx, v)
+		case "baseline":
+			return m.baseline(ctx, v)
+		case "up-to":
+			return m.upTo(ctx, v)
+		case "up-to-date":
+			return m.upToDate(ctx, date)
+		case "apply":
+			return m.applyVersion(ctx, v)
+		case "run":
+			return m.runFiles(ctx, args[1:])
+		case "force":
+			_, after, err := m.force(ctx, v)
+			if err != nil {
+				return 0, nil, err
+			}
+			n, err := runVersion(after)
+			return n, nil, err
+		case "pending":
+			return m.pending(ctx)
+		case "seed":
+			return m.seed(ctx)
+		case "plan":
+			return m.plan(ctx)
+		case "verify":
+			return m.verify(ctx)
+		case "list":
+			return m.listFiles()
+		case "history":
+			newestFirst, _ := historyOrder(args)
+			return m.historyFiles(ctx, newestFirst)
+		case "version":
+			v, file, err := m.current(ctx)
+			if err != nil {
+				return 0, nil, err
+			}
+			n, err := runVersion(v)
+			if file == "" {
+				return n, nil, err
+			}
+			return n, []string{file}, err
+		}
+		if fast, _ := statusMode(args); fast {
+			return m.statusFast(ctx)
+		}
+		return m.status(ctx)
+	})
+}
+
+// Up executes n pending migrations, all of them if n is 0
+func (m *Migrator) Up(ctx context.Context, n int) (int, []string, error) {
+	if n < 0 {
+		return 0, nil, ErrInvalidSyntax
+	}
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.up(ctx, n)
+	})
+}
+
+// Down reverts n executed migrations, all of them if n is 0
+func (m *Migrator) Down(ctx context.Context, n int) (int, []string, error) {
+	if n < 0 {
+		return 0, nil, ErrInvalidSyntax
+	}
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.down(ctx, 0, n)
+	})
+}
+
+// Goto migrates up or down to the version v, 0 reverts all migrations
+func (m *Migrator) Goto(ctx context.Context, v int64) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.gotoVersion(ctx, v)
+	})
+}
+
+// UpTo executes the pending migrations up to the version v
+func (m *Migrator) UpTo(ctx context.Context, v int64) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.upTo(ctx, v)
+	})
+}
+
+// UpToDate executes the pending migrations with timestamp versions at
+// or before t, see TimestampStrategy
+func (m *Migrator) UpToDate(ctx context.Context, t time.Time) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.upToDate(ctx, t)
+	})
+}
+
+// Apply executes only the migration with the version v, it fails with
+// ErrOutOfOrder when lower versions are pending unless AllowOutOfOrder is used
+func (m *Migrator) Apply(ctx context.Context, v int64) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.applyVersion(ctx, v)
+	})
+}
+
+// RunFiles executes only the named up files in the given order,
+// regardless of the other pending migrations
+func (m *Migrator) RunFiles(ctx context.Context, files ...string) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.runFiles(ctx, files)
+	})
+}
+
+// runVersion return v as the number returned by Run for the version
+// and force actions, it fails when v overflows int on 32-bit platforms
+func runVersion(v int64) (int, error) {
+	if int64(int(v)) != v {
+		return 0, fmt.Errorf("version %v overflows int, use the Version method", v)
+	}
+	return int(v), nil
+}
+
+// Version return the recorded migration version and its up file like
+// the Version method
+func Version(ctx context.Context, source, url string, opts ...Option) (v int64, file string, err error) {
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	return m.Version(ctx)
+}
+
+// Version return the recorded migration version and its up file,
+// the version is 0 when no migration was executed, the file is empty
+// when it isn't in the source
+func (m *Migrator) Version(ctx context.Context) (v int64, file string, err error) {
+	unlock, err := m.beginWithoutSource(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	v, file, err = m.current(ctx)
+	return
+}
+
+// Pending return the up files not recorded in schema_migrations,
+// unlike Status it doesn't verify the checksums
+func (m *Migrator) Pending(ctx context.Context) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.pending(ctx)
+	})
+}
+
+// Status return the number of pending migrations and their files
+func (m *Migrator) Status(ctx context.Context) (int, []string, error) {
+	s, err := m.StatusDetailed(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	files := make([]string, 0, len(s.Pending))
+	for _, p := range s.Pending {
+		files = append(files, p.Filename)
+	}
+	return len(files), files, nil
+}
+
+// StatusFast return the up files newer than the highest recorded
+// version, unlike Status it doesn't read the files nor the other
+// recorded versions, see the status fast action
+func (m *Migrator) StatusFast(ctx context.Context) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.statusFast(ctx)
+	})
+}
+
+// StatusDetailed check the db status like Status and return the
+// recorded versions and the pending migrations
+func (m *Migrator) StatusDetailed(ctx context.Context) (s *MigrationStatus, err error) {
+	unlock, err := m.begin(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	return m.statusDetailed(ctx)
+}
@@ -0,0 +1,139 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_newMigrator(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   []Option
+		table  string
+		err    error
+	}{
+		{name: "default table", source: "./testdata", table: "schema_migrations"},
+		{name: "table option", source: "./testdata", opts: []Option{TableName("app_migrations")}, table: "app_migrations"},
+		{name: "invalid table", source: "./testdata", opts: []Option{TableName("a;b")}, err: ErrInvalidTableName},
+		{name: "invalid schema", source: "./testdata", opts: []Option{Schema("tenant a")}, err: ErrInvalidSchemaName},
+		{name: "missing directory", source: "./testdata/missing", err: fs.ErrNotExist},
+		{name: "not a directory", source: "./testdata/001_name.up.sql", err: ErrNotDirectory},
+		{name: "empty source", source: " , ", err: ErrNoDirectory},
+		{name: "no migration files", source: t.TempDir(), err: ErrNoMigrationFiles},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMigrator(&postgresConfig, tt.source, tt.opts)
+			if err == nil {
+				// the source is checked by the first action
+				err = m.checkSource()
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("newMigrator() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if m.cfg.TableName != tt.table {
+				t.Errorf("expected table %v but got %v", tt.table, m.cfg.TableName)
+			}
+			if m.cfg == &postgresConfig {
+				t.Error("expected a copy of the database config")
+			}
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlx.Open("postgres", "postgres://postgres@localhost:5432/test?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := NewMigrator(db, nil, "./testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, executed, err := m.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 migrations executed but got %v", n)
+	}
+	n, _, err = m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected no pending migrations but got %v", n)
+	}
+	n, _, err = m.Goto(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 migrations reverted but got %v", n)
+	}
+	n, _, err = m.Down(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 migration reverted but got %v", n)
+	}
+	n, again, err := RunWithExistingDatabase(ctx, "./testdata", db, nil, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, executed) {
+		t.Errorf("expected %v executed but got %v", executed, again)
+	}
+	_, _, err = m.Down(ctx, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunEmptySource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations":         {Mode: fs.ModeDir},
+		"seeds/01_admin.sql": {Data: []byte("CREATE TABLE admin (id int);")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	for _, action := range []string{"unlock", "version", "seed"} {
+		_, _, err := Run(ctx, "migrations", url, action, WithFS(fsys))
+		if err != nil {
+			t.Errorf("expected %v with an empty migrations directory but got %v", action, err)
+		}
+	}
+	v, file, err := Version(ctx, "migrations", url, WithFS(fsys))
+	if err != nil || v != 0 || file != "" {
+		t.Errorf("expected version 0 but got %v %q %v", v, file, err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if !errors.Is(err, ErrNoMigrationFiles) {
+		t.Errorf("expected ErrNoMigrationFiles but got %v", err)
+	}
+	// a server that only runs the application has no migration files
+	_, _, err = Run(ctx, "migrations", url, "up", WithFS(fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, file, err = Version(ctx, "migrations", url, WithFS(fsys))
+	if err != nil || v != 1 || file != "" {
+		t.Errorf("expected version 1 without a file but got %v %q %v", v, file, err)
+	}
+}
@@ -0,0 +1,395 @@
+package migration
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Option changes the default behavior of Run
+type Option func(*options)
+
+type options struct {
+	dryRun          io.Writer
+	src             Source
+	strategy        VersionStrategy
+	warn            io.Writer
+	strictChecksums bool
+	requireDown     bool
+	perMigrationTx  bool
+	allowMissing    bool
+	outOfOrder      bool
+	baselineOnly    bool
+	forceBaseline   bool
+	ssl             SSLConfig
+	pool            PoolConfig
+	recursive       bool
+	expand          bool
+	fake            bool
+	seeds           string
+	tag             string
+	schema          string
+	vars            map[string]string
+	templateVars    map[string]string
+	table           string
+	split           bool
+	log             Logger
+	retries         int
+	lockTimeout     time.Duration
+	lockTTL         time.Duration
+	onApplied       func(file string, d time.Duration)
+	protect         bool
+	confirm         bool
+	connectRetries  int
+	connectBackoff  time.Duration
+	verbose         io.Writer
+	beforeAll       GoMigration
+	afterAll        GoMigration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		src:            FSSource(osFS{}),
+		strategy:       SequentialStrategy{},
+		warn:           os.Stderr,
+		retries:        -1,
+		connectBackoff: time.Second,
+		seeds:          defaultSeedsDir,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.log == nil {
+		o.log = textLogger{w: o.warn}
+	}
+	if s, ok := o.src.(fsSource); ok && o.recursive {
+		o.src = recursiveFS{s}
+	}
+	return o
+}
+
+// DryRun makes Run print the selected migration files and the
+// schema_migrations changes to w instead of executing them
+func DryRun(w io.Writer) Option {
+	return func(o *options) {
+		o.dryRun = w
+	}
+}
+
+// WithFS makes Run read the migrations source directory from fsys,
+// e.g. an embed.FS, instead of the operating system filesystem
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.src = FSSource(fsys)
+	}
+}
+
+// Recursive makes Run search the migration files in the subdirectories
+// of the migrations directories too, e.g. migrations/2024, it is
+// ignored by sources set with WithSource
+func Recursive() Option {
+	return func(o *options) {
+		o.recursive = true
+	}
+}
+
+// ExpandVars replaces ${NAME} in the migration SQL with the value of
+// vars, or of the environment variables when vars is nil, it fails
+// when a variable is not defined, the comments are kept as written
+// and $${NAME} is the literal ${NAME}
+func ExpandVars(vars map[string]string) Option {
+	return func(o *options) {
+		o.expand = true
+		o.vars = vars
+	}
+}
+
+// TemplateVars sets values of the .sql.tmpl migration templates, they
+// replace the keys of the template data file with the same name
+func TemplateVars(vars map[string]string) Option {
+	return func(o *options) {
+		o.templateVars = vars
+	}
+}
+
+// Fake makes up and down change the recorded migrations without
+// executing the migration files, e.g. after running the SQL by hand
+func Fake() Option {
+	return func(o *options) {
+		o.fake = true
+	}
+}
+
+// Schema makes Run set the PostgreSQL search_path of the connection, the
+// migrations table and the objects are created in that schema, the
+// other databases ignore it
+func Schema(name string) Option {
+	return func(o *options) {
+		o.schema = name
+	}
+}
+
+// Tag limits the migrations to the files with tag in the name
+// after the version, e.g. billing for 002_billing_invoices.up.sql
+func Tag(tag string) Option {
+	return func(o *options) {
+		o.tag = tag
+	}
+}
+
+// SeedsDir sets the directory of the files executed by the seed
+// action, the default is seeds
+func SeedsDir(dir string) Option {
+	return func(o *options) {
+		o.seeds = dir
+	}
+}
+
+// WithSource makes Run list and read the migration files from src
+func WithSource(src Source) Option {
+	return func(o *options) {
+		o.src = src
+	}
+}
+
+// StrictChecksums makes up and status fail instead of warn
+// when an executed migration file was changed
+func StrictChecksums() Option {
+	return func(o *options) {
+		o.strictChecksums = true
+	}
+}
+
+// RequireDown makes up fail before executing anything when a pending
+// migration has no down file
+func RequireDown() Option {
+	return func(o *options) {
+		o.requireDown = true
+	}
+}
+
+// PerMigrationTx commits each migration of a batch in its own
+// transaction, a failure stops the batch and keeps the migrations
+// executed before it, by default the batch is one transaction and a
+// failure rolls all of it back
+func PerMigrationTx() Option {
+	return func(o *options) {
+		o.perMigrationTx = true
+	}
+}
+
+// AllowMissing lets force record a version without a migration file
+func AllowMissing() Option {
+	return func(o *options) {
+		o.allowMissing = true
+	}
+}
+
+// AllowOutOfOrder makes apply execute a migration when lower versions
+// are still pending and makes up warn instead of failing when there
+// are pending migrations below the recorded version
+func AllowOutOfOrder() Option {
+	return func(o *options) {
+		o.outOfOrder = true
+	}
+}
+
+// BaselineOnly makes baseline record only the baseline version
+// instead of all the versions up to it, status still reports
+// the lower versions as pending
+func BaselineOnly() Option {
+	return func(o *options) {
+		o.baselineOnly = true
+	}
+}
+
+// ForceBaseline makes baseline replace the recorded migrations
+// instead of failing when the migrations table has rows
+func ForceBaseline() Option {
+	return func(o *options) {
+		o.forceBaseline = true
+	}
+}
+
+// WithSSL sets the SSL parameters of PostgreSQL connections,
+// they are ignored by the other databases
+func WithSSL(ssl SSLConfig) Option {
+	return func(o *options) {
+		o.ssl = ssl
+	}
+}
+
+// WithPool sets the connection pool of the database opened by
+// Run, an in-memory SQLite always uses a single connection
+func WithPool(pool PoolConfig) Option {
+	return func(o *options) {
+		o.pool = pool
+	}
+}
+
+// WithVersionStrategy sets how the versions are parsed from the
+// migration file names and ordered, nil restores SequentialStrategy,
+// Go migrations always use SequentialStrategy
+func WithVersionStrategy(s VersionStrategy) Option {
+	return func(o *options) {
+		if s == nil {
+			s = SequentialStrategy{}
+		}
+		o.strategy = s
+	}
+}
+
+// TableName sets the table that records the executed
+// migrations, the default is schema_migrations
+func TableName(name string) Option {
+	return func(o *options) {
+		o.table = name
+	}
+}
+
+// SplitStatements makes each statement of the migration files run in
+// its own ExecContext call, for drivers that execute only the first one
+func SplitStatements() Option {
+	return func(o *options) {
+		o.split = true
+	}
+}
+
+// Warnings sets where warnings are written, the default is os.Stderr
+func Warnings(w io.Writer) Option {
+	return func(o *options) {
+		o.warn = w
+	}
+}
+
+// WithLogger sends the warnings and a log line for each executed
+// or failed migration to l instead of writing the warnings to the
+// Warnings writer
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// Retries sets how many times a migration transaction is executed
+// again after a serialization failure, the default is 3 for
+// CockroachDB and 0 for the other databases
+func Retries(n int) Option {
+	return func(o *options) {
+		o.retries = n
+	}
+}
+
+// LockTimeout makes the migrations fail instead of waiting more
+// than d for a table lock, it is ignored by databases without
+// LockTimeoutSQL, with LockTable it limits the wait for the lock table
+func LockTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = d
+	}
+}
+
+// LockTTL makes a run take over the lock table claimed more than d
+// ago, the claim of a killed run is never released otherwise, d must
+// be longer than the slowest migration, it is ignored by session locks
+func LockTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.lockTTL = d
+	}
+}
+
+// OnApplied calls fn after each executed migration with
+// the migration file and how long it took
+func OnApplied(fn func(file string, d time.Duration)) Option {
+	return func(o *options) {
+		o.onApplied = fn
+	}
+}
+
+// ProtectDestructive makes down, force and goto to a lower version
+// fail unless ConfirmDestructive is used or the environment variable
+// MIGRATION_ALLOW_DESTRUCTIVE is 1
+func ProtectDestructive() Option {
+	return func(o *options) {
+		o.protect = true
+	}
+}
+
+// ConfirmDestructive allows the actions blocked by ProtectDestructive
+func ConfirmDestructive() Option {
+	return func(o *options) {
+		o.confirm = true
+	}
+}
+
+// ConnectRetries makes Run try to connect to the database n more
+// times when the connection fails, e.g. while the database starts
+func ConnectRetries(n int) Option {
+	return func(o *options) {
+		o.connectRetries = n
+	}
+}
+
+// ConnectBackoff sets the wait before the first connection retry,
+// it doubles on each retry, the default is one second
+func ConnectBackoff(d time.Duration) Option {
+	return func(o *options) {
+		o.connectBackoff = d
+	}
+}
+
+// Verbose writes each SQL statement to w right before it is executed
+func Verbose(w io.Writer) Option {
+	return func(o *options) {
+		o.verbose = w
+	}
+}
+
+// BeforeAll runs fn in the transaction of the first migration executed
+// by up, down or goto, before the migration, it is not recorded
+func BeforeAll(fn GoMigration) Option {
+	return func(o *options) {
+		o.beforeAll = fn
+	}
+}
+
+// AfterAll runs fn in the transaction of the last migration executed
+// by up, down or goto, after the migration, it is not recorded
+func AfterAll(fn GoMigration) Option {
+	return func(o *options) {
+		o.afterAll = fn
+	}
+}
+
+// SQLHook return a BeforeAll or AfterAll hook that executes sql
+func SQLHook(sql string) GoMigration {
+	return func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, sql)
+		return err
+	}
+}
+
+// osFS is the default fs.FS, unlike os.DirFS it accepts
+// relative and absolute paths of the operating system
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name) // nolint
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name) // nolint
+}
+
+func (osFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
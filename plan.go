@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// plan executes the pending migrations in one transaction that is
+// always rolled back, it returns the files executed without error
+// and the *MigrationError of the first one that failed
+func (m *Migrator) plan(ctx context.Context) (number int, executed []string, err error) {
+	if !m.cfg.SupportsTransactionalDDL {
+		err = fmt.Errorf("plan: %w: %v", ErrNoTransactionalDDL, m.cfg.DatabaseType)
+		return
+	}
+	if m.tx != nil {
+		err = errors.New("plan can't roll back the transaction of the caller")
+		return
+	}
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	start, err := m.appliedIndex(ctx, files)
+	if err != nil {
+		return
+	}
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	defer m.rollback(tx)
+	for _, f := range files[start:] {
+		var run GoMigration
+		run, _, err = m.migrationFunc(f, "up")
+		if err == nil {
+			err = run(ctx, tx)
+		}
+		if err != nil {
+			m.opts.log.Error(fmt.Sprintf("plan failed in %v: %v", f, err), "file", f, "error", err)
+			err = &MigrationError{file: f, err: err}
+			return
+		}
+		m.opts.log.Info(fmt.Sprintf("plan executed %v", f), "file", f)
+		number++
+		executed = append(executed, f)
+	}
+	return
+}
+
+// Plan executes the pending migrations in a transaction that is rolled
+// back, to check them against the database without changing it
+func (m *Migrator) Plan(ctx context.Context) (int, []string, error) {
+	return m.locked(ctx, func() (int, []string, error) {
+		return m.plan(ctx)
+	})
+}
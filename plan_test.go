@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunPlan(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int, a_id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/003_c.up.sql":   {Data: []byte("INSERT INTO b (id, a_id) VALUES (1, 1);")},
+		"migrations/003_c.down.sql": {Data: []byte("DELETE FROM b;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(ctx, "migrations", url, "up 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "plan", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/002_b.up.sql", "migrations/003_c.up.sql"}
+	if n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v planned but got %v %v", want, n, executed)
+	}
+	n, pending, err := Run(ctx, "migrations", url, "pending", WithFS(fsys))
+	if err != nil || n != 2 {
+		t.Errorf("expected the 2 migrations still pending but got %v %v %v", n, pending, err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "up 1", WithFS(fsys))
+	if err != nil {
+		t.Errorf("expected b to be created by up after the plan but got %v", err)
+	}
+
+	fsys["migrations/004_d.up.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO d (id) VALUES (1);")}
+	fsys["migrations/004_d.down.sql"] = &fstest.MapFile{Data: []byte("DELETE FROM d;")}
+	n, executed, err = Run(ctx, "migrations", url, "plan", WithFS(fsys))
+	var merr *MigrationError
+	if !errors.As(err, &merr) || merr.File() != "migrations/004_d.up.sql" {
+		t.Errorf("expected the plan to fail in 004_d but got %v", err)
+	}
+	if n != 1 || !reflect.DeepEqual(executed, []string{"migrations/003_c.up.sql"}) {
+		t.Errorf("expected 003_c planned before the failure but got %v %v", n, executed)
+	}
+	n, _, err = Run(ctx, "migrations", url, "pending", WithFS(fsys))
+	if err != nil || n != 2 {
+		t.Errorf("expected the 2 migrations still pending but got %v %v", n, err)
+	}
+
+	cfg := sqliteConfig
+	cfg.SupportsTransactionalDDL = false
+	m, err := newMigrator(&cfg, "migrations", []Option{WithFS(fsys)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = m.plan(ctx)
+	if !errors.Is(err, ErrNoTransactionalDDL) {
+		t.Errorf("expected ErrNoTransactionalDDL but got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PoolConfig holds the database/sql connection pool settings,
+// the zero fields keep the driver defaults, MaxOpenConns is at least
+// 2 with a session lock because the lock keeps a connection
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// minLockConns is the smallest pool with a session lock, the lock
+// connection and the connection of the migrations
+const minLockConns = 2
+
+// setPool applies the pool settings to db, an in-memory SQLite
+// keeps a single connection that is never closed because each
+// connection has its own database
+func setPool(db *sqlx.DB, pool PoolConfig, cfg *DatabaseConfig, url string) {
+	if cfg.DatabaseType == sqliteConfig.DatabaseType && isMemory(url) {
+		return
+	}
+	if cfg.LockSQL != "" && !cfg.LockTable && pool.MaxOpenConns > 0 {
+		// with a single connection the transactions would wait forever
+		// for the connection held by the lock
+		pool.MaxOpenConns = max(pool.MaxOpenConns, minLockConns)
+	}
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+}
@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWithPool(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/1_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	pool := PoolConfig{MaxOpenConns: 3, MaxIdleConns: 2, ConnMaxLifetime: time.Minute}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	m, err := openMigrator(context.Background(), "migrations", url, []Option{WithFS(fsys), WithPool(pool)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.db.Close()
+	if n := m.db.Stats().MaxOpenConnections; n != 3 {
+		t.Errorf("expected 3 max open connections but got %v", n)
+	}
+
+	m, err = openMigrator(context.Background(), "migrations", "sqlite://:memory:", []Option{WithFS(fsys), WithPool(pool)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.db.Close()
+	if n := m.db.Stats().MaxOpenConnections; n != 1 {
+		t.Errorf("expected an in-memory SQLite with 1 connection but got %v", n)
+	}
+
+	m, err = openMigrator(context.Background(), "migrations", url, []Option{WithFS(fsys)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.db.Close()
+	if n := m.db.Stats().MaxOpenConnections; n != 0 {
+		t.Errorf("expected the default unlimited connections but got %v", n)
+	}
+}
+
+func TestWithPoolSessionLock(t *testing.T) {
+	cfg := sqliteConfig
+	cfg.LockTable = false
+	cfg.LockSQL = "SELECT 1"
+	cfg.UnlockSQL = "SELECT 1"
+	RegisterDatabase("sqlitelock", cfg, func(url string) string {
+		return sqliteConnString("sqlite" + strings.TrimPrefix(url, "sqlitelock"))
+	})
+	t.Cleanup(func() { unregisterDatabase("sqlitelock") })
+	fsys := fstest.MapFS{
+		"migrations/1_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := "sqlitelock://" + filepath.Join(t.TempDir(), "test.db")
+	n, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), WithPool(PoolConfig{MaxOpenConns: 1}))
+	if err != nil || n != 1 {
+		t.Errorf("expected the migration executed with a one connection pool but got %v %v", n, err)
+	}
+}
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// errorPosition return the 1-based character position of the error
+// in the statement, lib/pq and pgx report it for syntax errors
+func errorPosition(err error) int {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		p, _ := strconv.Atoi(pqErr.Position)
+		return p
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return int(pgErr.Position)
+	}
+	return 0
+}
+
+// withPosition adds the line, column and SQL line of the error to err,
+// stmt starts at the byte offset start of sql, without a position from
+// the driver the start of the statement is used when sql has more than
+// one statement, e.g. for SQLite with SplitStatements
+func withPosition(err error, sql, stmt string, start int) error {
+	offset := start
+	if p := errorPosition(err); p > 0 {
+		runes := []rune(stmt)
+		if p > len(runes) {
+			p = len(runes)
+		}
+		offset += len(string(runes[:p-1]))
+	} else if strings.TrimSpace(sql) == strings.TrimSpace(stmt) {
+		return err
+	}
+	line := strings.Count(sql[:offset], "\n") + 1
+	lineStart := strings.LastIndex(sql[:offset], "\n") + 1
+	column := len([]rune(sql[lineStart:offset])) + 1
+	text := sql[lineStart:]
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return fmt.Errorf("%w (line %v, column %v: %v)", err, line, column, strings.TrimSpace(text))
+}
@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+func Test_withPosition(t *testing.T) {
+	sql := "CREATE TABLE a (id int);\n\nINSERT INTO a\n  VALUES (1;\n"
+	cases := []struct {
+		name string
+		err  error
+		stmt string
+		want string
+	}{
+		{
+			name: "pq",
+			err:  &pq.Error{Message: "syntax error at or near \";\"", Position: "52"},
+			stmt: sql,
+			want: "(line 4, column 12: VALUES (1;)",
+		},
+		{
+			name: "pgx",
+			err:  &pgconn.PgError{Message: "syntax error", Position: 1},
+			stmt: sql,
+			want: "(line 1, column 1: CREATE TABLE a (id int);)",
+		},
+		{
+			name: "split statement without position",
+			err:  errors.New("near \";\": syntax error"),
+			stmt: "INSERT INTO a\n  VALUES (1;",
+			want: "(line 3, column 1: INSERT INTO a)",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			start := strings.Index(sql, c.stmt)
+			err := withPosition(c.err, sql, c.stmt, start)
+			if !errors.Is(err, c.err) || !strings.HasSuffix(err.Error(), c.want) {
+				t.Errorf("expected %q but got %q", c.want, err)
+			}
+		})
+	}
+	err := errors.New("no such table: b")
+	if got := withPosition(err, sql, sql, 0); got != err {
+		t.Errorf("expected the error unchanged but got %v", got)
+	}
+}
+
+func TestRunErrorLine(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);\n\nINSERT INTO a\n  VALUES (1;\n")},
+		"migrations/1_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(context.Background(), "migrations", url, "up", WithFS(fsys), SplitStatements())
+	if !errors.Is(err, ErrMigrationFailed) || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected the failed statement line but got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package migration
+
+import (
+	"context"
+	"io/fs"
+	"time"
+)
+
+// StatusReport is the machine readable state of the migrations
+type StatusReport struct {
+	Database string             `json:"database"`
+	Version  int64              `json:"version"`
+	Applied  int                `json:"applied"`
+	Pending  []PendingMigration `json:"pending"`
+	History  []AppliedMigration `json:"history"`
+	Orphaned []int64            `json:"orphaned"`
+}
+
+// AppliedMigration is a migration recorded as executed, AppliedAt
+// is nil and Name empty for migrations executed before they were
+// recorded
+type AppliedMigration struct {
+	Version   int64      `json:"version" db:"version"`
+	Name      string     `json:"name,omitempty" db:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty" db:"applied_at"`
+}
+
+// PendingMigration is a migration file not executed yet
+type PendingMigration struct {
+	Version int64  `json:"version"`
+	File    string `json:"file"`
+	Size    int64  `json:"size"`
+}
+
+// MigrationStatus is the state of the migrations returned by StatusDetailed
+type MigrationStatus struct {
+	CurrentVersion int64       `json:"current_version"`
+	Applied        []int64     `json:"applied"`
+	Pending        []Migration `json:"pending"`
+	UpToDate       bool        `json:"up_to_date"`
+}
+
+// Migration is a migration file
+type Migration struct {
+	Version  int64  `json:"version"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// Report check the db status like the status action and
+// return the details about the executed and pending migrations
+func Report(ctx context.Context, source, url string, opts ...Option) (r *StatusReport, err error) {
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	r, err = m.Report(ctx)
+	return
+}
+
+// Report return the details about the executed and pending migrations
+func (m *Migrator) Report(ctx context.Context) (r *StatusReport, err error) {
+	unlock, err := m.begin(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	r = &StatusReport{
+		Database: m.cfg.DatabaseType,
+		Pending:  []PendingMigration{},
+		Orphaned: []int64{},
+	}
+	r.Version, err = migrationMax(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	r.Applied, err = migrationCount(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	r.History, err = appliedMigrations(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	_, pending, err := m.status(ctx)
+	if err != nil {
+		return
+	}
+	for _, f := range pending {
+		var p PendingMigration
+		p, err = pendingMigration(m.opts.strategy, m.opts.src, f)
+		if err != nil {
+			return
+		}
+		r.Pending = append(r.Pending, p)
+	}
+	// the files of the other tags are not orphaned
+	files, err := upFiles(m.opts.strategy, m.opts.src, m.source)
+	if err != nil {
+		return
+	}
+	byVersion, err := fileVersions(m.opts.strategy, files)
+	if err != nil {
+		return
+	}
+	r.Orphaned = orphaned(r.History, byVersion)
+	return
+}
+
+// orphaned return the versions recorded as applied that have
+// no up file anymore
+func orphaned(history []AppliedMigration, byVersion map[int64]string) (versions []int64) {
+	versions = []int64{}
+	for _, h := range history {
+		if _, ok := byVersion[h.Version]; !ok && h.Version > 0 {
+			versions = append(versions, h.Version)
+		}
+	}
+	return
+}
+
+func (m *Migrator) statusDetailed(ctx context.Context) (s *MigrationStatus, err error) {
+	s = &MigrationStatus{Pending: []Migration{}}
+	s.CurrentVersion, err = migrationMax(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	s.Applied, err = appliedVersions(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	_, pending, err := m.status(ctx)
+	if err != nil {
+		return
+	}
+	for _, f := range pending {
+		var p PendingMigration
+		p, err = pendingMigration(m.opts.strategy, m.opts.src, f)
+		if err != nil {
+			return
+		}
+		s.Pending = append(s.Pending, Migration{Version: p.Version, Filename: p.File, Size: p.Size})
+	}
+	s.UpToDate = len(s.Pending) == 0
+	return
+}
+
+func pendingMigration(vs VersionStrategy, src Source, file string) (p PendingMigration, err error) {
+	p.File = file
+	p.Version, err = version(vs, file)
+	if err != nil {
+		return
+	}
+	if _, ok := registeredGo(file); ok {
+		return
+	}
+	if s, ok := src.(statSource); ok {
+		var info fs.FileInfo
+		info, err = s.Stat(file)
+		if err != nil {
+			return
+		}
+		p.Size = info.Size()
+		return
+	}
+	b, err := readFile(src, file)
+	if err != nil {
+		return
+	}
+	p.Size = int64(len(b))
+	return
+}
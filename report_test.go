@@ -0,0 +1,181 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_version(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    int64
+		wantErr bool
+	}{
+		{name: "up file", file: "testdata/001_name.up.sql", want: 1},
+		{name: "down file", file: "testdata/003_a_name.down.sql", want: 3},
+		{name: "without prefix", file: "testdata/name.up.sql", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := version(SequentialStrategy{}, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("version() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("version() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pendingMigration(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/002_b.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+	}
+	p, err := pendingMigration(SequentialStrategy{}, FSSource(fsys), "migrations/002_b.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PendingMigration{Version: 2, File: "migrations/002_b.up.sql", Size: 24}
+	if p != want {
+		t.Errorf("pendingMigration() = %v, want %v", p, want)
+	}
+}
+
+func TestReport(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	_, _, err := Run(context.Background(), source, url, "up 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Run(context.Background(), source, url, "down") // nolint
+	r, err := Report(context.Background(), source, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Database != "postgres" {
+		t.Errorf("expected database %v but got %v", "postgres", r.Database)
+	}
+	if r.Version != 1 || r.Applied != 1 {
+		t.Errorf("expected version 1 and 1 applied but got %v and %v", r.Version, r.Applied)
+	}
+	if len(r.Pending) != 2 || r.Pending[0].Version != 2 || r.Pending[0].Size == 0 {
+		t.Errorf("unexpected pending migrations %+v", r.Pending)
+	}
+	if len(r.History) != 1 || r.History[0].AppliedAt == nil {
+		t.Fatalf("expected one applied migration with applied_at but got %+v", r.History)
+	}
+	if time.Since(*r.History[0].AppliedAt) > time.Minute {
+		t.Errorf("unexpected applied_at %v", r.History[0].AppliedAt)
+	}
+}
+
+func TestReportUpgradedTable(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := "./testdata"
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`DROP TABLE IF EXISTS schema_migrations;
+CREATE TABLE schema_migrations (version bigint NOT NULL, CONSTRAINT schema_migrations_pkey PRIMARY KEY (version));
+INSERT INTO schema_migrations (version) VALUES (1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DROP TABLE schema_migrations`) // nolint
+	r, err := Report(context.Background(), source, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.History) != 1 || r.History[0].Version != 1 || r.History[0].AppliedAt != nil {
+		t.Errorf("expected version 1 without applied_at but got %+v", r.History)
+	}
+}
+
+func TestStatusDetailed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := NewMigrator(db, nil, "migrations", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = m.Up(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.StatusDetailed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MigrationStatus{
+		CurrentVersion: 1,
+		Applied:        []int64{1},
+		Pending:        []Migration{{Version: 2, Filename: "migrations/002_b.up.sql", Size: 24}},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("StatusDetailed() = %+v, want %+v", s, want)
+	}
+	n, files, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !reflect.DeepEqual(files, []string{"migrations/002_b.up.sql"}) {
+		t.Errorf("Status() = %v %v, want the pending file", n, files)
+	}
+}
+
+func TestReportOrphaned(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	_, _, err := Run(ctx, "migrations", url, "up 1", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO schema_migrations (version) VALUES (9)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Report(ctx, "migrations", url, WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{9}; !reflect.DeepEqual(r.Orphaned, want) {
+		t.Errorf("expected the orphaned versions %v but got %v", want, r.Orphaned)
+	}
+	if len(r.Pending) != 1 || r.Pending[0].Version != 2 {
+		t.Errorf("expected only version 2 pending but got %v", r.Pending)
+	}
+}
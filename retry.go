@@ -0,0 +1,14 @@
+package migration
+
+import "errors"
+
+// sqlStateSerializationFailure is returned by CockroachDB and by
+// PostgreSQL serializable transactions that must be executed again
+const sqlStateSerializationFailure = "40001"
+
+// retryable report if err is a serialization failure, drivers
+// like lib/pq and pgx expose the SQLSTATE code with SQLState
+func retryable(err error) bool {
+	var e interface{ SQLState() string }
+	return errors.As(err, &e) && e.SQLState() == sqlStateSerializationFailure
+}
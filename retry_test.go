@@ -0,0 +1,31 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func Test_retryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "serialization failure", err: &pq.Error{Code: "40001"}, want: true},
+		{name: "migration error", err: &MigrationError{file: "001_a.up.sql", err: &pq.Error{Code: "40001"}}, want: true},
+		{name: "wrapped", err: fmt.Errorf("commit: %w", &pq.Error{Code: "40001"}), want: true},
+		{name: "syntax error", err: &pq.Error{Code: "42601"}, want: false},
+		{name: "other error", err: errors.New("40001"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// runFiles executes only the named up files in the given order, a name
+// is the file name or its path in the migrations dir, the already
+// executed files are skipped and the lower pending versions are ignored
+func (m *Migrator) runFiles(ctx context.Context, names []string) (number int, executed []string, err error) {
+	files, err := m.upFiles()
+	if err != nil {
+		return
+	}
+	idx := make([]int, 0, len(names))
+	versions := make([]int64, 0, len(names))
+	for _, name := range names {
+		i, v, err := fileIndex(m.opts.strategy, files, name)
+		if err != nil {
+			return 0, nil, err
+		}
+		idx = append(idx, i)
+		versions = append(versions, v)
+	}
+	applied, err := appliedSet(ctx, m.conn(), m.cfg)
+	if err != nil {
+		return
+	}
+	for k, i := range idx {
+		v := versions[k]
+		if applied[v] {
+			continue
+		}
+		var n int
+		var e []string
+		n, e, err = m.execUp(ctx, files, i, 1)
+		number += n
+		executed = append(executed, e...)
+		if err != nil {
+			return
+		}
+		applied[v] = true
+	}
+	return
+}
+
+// fileIndex return the position and the version of the up file name in files
+func fileIndex(vs VersionStrategy, files []string, name string) (int, int64, error) {
+	for i, f := range files {
+		if f != name && path.Base(f) != name {
+			continue
+		}
+		v, err := version(vs, f)
+		return i, v, err
+	}
+	return 0, 0, fmt.Errorf("%w: %v", ErrMissingUpFile, name)
+}
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scriptComment starts the comments of the action scripts
+const scriptComment = "#"
+
+// ScriptStep is the result of an action of a script
+type ScriptStep struct {
+	Action   string   `json:"action"`
+	Number   int      `json:"number"`
+	Executed []string `json:"executed"`
+}
+
+// ReadScript return the actions of r, one per line, the blank
+// lines and the text after # are ignored
+func ReadScript(r io.Reader) (actions []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		action := scanner.Text()
+		if i := strings.Index(action, scriptComment); i >= 0 {
+			action = action[:i]
+		}
+		action = strings.Join(strings.Fields(action), " ")
+		if action == "" {
+			continue
+		}
+		_, err = parseAction(action)
+		if err != nil {
+			err = fmt.Errorf("line %v: %w", line, err)
+			return
+		}
+		actions = append(actions, action)
+	}
+	err = scanner.Err()
+	if err == nil && len(actions) == 0 {
+		err = ErrEmptyAction
+	}
+	return
+}
+
+// RunScript performs in order the actions read from r over one
+// connection, the steps before a failed action are returned with
+// the error
+func RunScript(ctx context.Context, source, url string, r io.Reader, opts ...Option) (steps []ScriptStep, err error) {
+	actions, err := ReadScript(r)
+	if err != nil {
+		return
+	}
+	m, err := openMigrator(ctx, source, url, opts)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	for _, action := range actions {
+		step := ScriptStep{Action: action}
+		step.Number, step.Executed, err = m.Run(ctx, action)
+		if err != nil {
+			err = fmt.Errorf("%v: %w", action, err)
+			return
+		}
+		steps = append(steps, step)
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	script := `# deploy
+up
+
+down 1  # keep only a
+status
+`
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	steps, err := RunScript(context.Background(), "migrations", url, strings.NewReader(script), WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScriptStep{
+		{Action: "up", Number: 2, Executed: []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql"}},
+		{Action: "down 1", Number: 1, Executed: []string{"migrations/002_b.down.sql"}},
+		{Action: "status", Number: 1, Executed: []string{"migrations/002_b.up.sql"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %+v but got %+v", want, steps)
+	}
+
+	_, err = RunScript(context.Background(), "migrations", url, strings.NewReader("up\ngoto 1 2\n"), WithFS(fsys))
+	if !errors.Is(err, ErrInvalidParameters) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an invalid parameters error in line 2 but got %v", err)
+	}
+	_, err = RunScript(context.Background(), "migrations", url, strings.NewReader("# nothing\n\n"), WithFS(fsys))
+	if !errors.Is(err, ErrEmptyAction) {
+		t.Errorf("expected ErrEmptyAction but got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultSeedsDir is the directory of the seed files
+const defaultSeedsDir = "seeds"
+
+// seed executes the .sql files of the seeds directory in lexical order
+// in a single transaction, they are not recorded in schema_migrations
+// so they must be idempotent, e.g. with INSERT ... ON CONFLICT DO NOTHING
+func (m *Migrator) seed(ctx context.Context) (n int, executed []string, err error) {
+	files, err := m.opts.src.List(path.Join(m.opts.seeds, "*.sql"))
+	if err != nil {
+		return
+	}
+	if len(files) == 0 {
+		err = fmt.Errorf("%w in %v", ErrNoMigrationFiles, m.opts.seeds)
+		return
+	}
+	sort.Strings(files)
+	if m.opts.dryRun != nil {
+		for _, f := range files {
+			var b []byte
+			b, err = readFile(m.opts.src, f)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(m.opts.dryRun, "-- %v\n%s\n\n", f, strings.TrimSpace(string(b))) // nolint
+		}
+		return len(files), files, nil
+	}
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		var b []byte
+		b, err = readFile(m.opts.src, f)
+		if err != nil {
+			m.rollback(tx)
+			return 0, nil, err
+		}
+		b = bytes.TrimPrefix(b, utf8BOM)
+		if m.opts.verbose != nil {
+			fmt.Fprintf(m.opts.verbose, "-- %v\n%v\n", f, strings.TrimSpace(string(b))) // nolint
+		}
+		_, err = tx.ExecContext(ctx, string(b))
+		if err != nil {
+			m.rollback(tx)
+			return 0, nil, &MigrationError{file: f, err: err}
+		}
+	}
+	err = m.commit(tx)
+	if err != nil {
+		return
+	}
+	m.opts.log.Info("seeds loaded", "dir", m.opts.seeds, "files", len(files))
+	return len(files), files, nil
+}
+
+// Seed executes the seed files, see SeedsDir
+func (m *Migrator) Seed(ctx context.Context) (int, []string, error) {
+	return m.lockedWithoutSource(ctx, func() (int, []string, error) {
+		return m.seed(ctx)
+	})
+}
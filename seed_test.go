@@ -0,0 +1,65 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRunSeed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_roles.up.sql":   {Data: []byte("CREATE TABLE roles (name text PRIMARY KEY);")},
+		"migrations/001_roles.down.sql": {Data: []byte("DROP TABLE roles;")},
+		"seeds/02_users.sql":            {Data: []byte("INSERT OR IGNORE INTO roles (name) VALUES ('user');")},
+		"seeds/01_admin.sql":            {Data: []byte("INSERT OR IGNORE INTO roles (name) VALUES ('admin');")},
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		n, executed, err := Run(ctx, "migrations", url, "seed", WithFS(fsys))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"seeds/01_admin.sql", "seeds/02_users.sql"}
+		if n != 2 || !reflect.DeepEqual(executed, want) {
+			t.Errorf("expected %v executed but got %v %v", want, n, executed)
+		}
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var roles []string
+	err = db.Select(&roles, `SELECT name FROM roles ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roles, []string{"admin", "user"}) {
+		t.Errorf("expected the seeded roles but got %v", roles)
+	}
+	versions, err := AppliedVersions(ctx, db, driverConfig("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []int64{1}) {
+		t.Errorf("expected the seeds not recorded but got %v", versions)
+	}
+	fsys["data/01_bad.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO missing (id) VALUES (1);")}
+	_, _, err = Run(ctx, "migrations", url, "seed", WithFS(fsys), SeedsDir("data"))
+	var merr *MigrationError
+	if !errors.As(err, &merr) || !strings.HasSuffix(merr.File(), "01_bad.sql") {
+		t.Errorf("expected the failed seed file but got %v", err)
+	}
+}
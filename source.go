@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// Source lists and opens the migration files, implement it to read
+// the migrations from a remote store, e.g. an S3 bucket
+type Source interface {
+	// List return the file names that match the path.Match pattern
+	List(pattern string) ([]string, error)
+	// Open return the contents of the named file
+	Open(name string) (io.ReadCloser, error)
+}
+
+// FSSource return a Source that reads the migration files from fsys
+func FSSource(fsys fs.FS) Source {
+	return fsSource{fsys: fsys}
+}
+
+type fsSource struct {
+	fsys fs.FS
+}
+
+func (s fsSource) List(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s fsSource) Open(name string) (io.ReadCloser, error) {
+	return s.fsys.Open(name)
+}
+
+func (s fsSource) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// recursiveFS is a fsSource that lists the matching files
+// of the subdirectories too
+type recursiveFS struct {
+	fsSource
+}
+
+func (s recursiveFS) List(pattern string) (files []string, err error) {
+	dir, name := path.Split(pattern)
+	err = fs.WalkDir(s.fsys, path.Clean(dir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ok, err := path.Match(name, d.Name())
+		if ok {
+			files = append(files, p)
+		}
+		return err
+	})
+	return
+}
+
+// statSource is implemented by the sources that can tell if a
+// migrations directory exists
+type statSource interface {
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// readFile return the contents of the named file of src
+func readFile(src Source, name string) (b []byte, err error) {
+	r, err := src.Open(name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		cerr := r.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	return io.ReadAll(r)
+}
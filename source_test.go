@@ -0,0 +1,117 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// memSource is a Source that keeps the migration files in memory
+type memSource map[string]string
+
+func (s memSource) List(pattern string) (files []string, err error) {
+	for name := range s {
+		var ok bool
+		ok, err = path.Match(pattern, name)
+		if err != nil {
+			return
+		}
+		if ok {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return
+}
+
+func (s memSource) Open(name string) (io.ReadCloser, error) {
+	data, ok := s[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func TestRunWithSource(t *testing.T) {
+	src := memSource{
+		"migrations/001_a.up.sql":   "CREATE TABLE a (id int);",
+		"migrations/001_a.down.sql": "DROP TABLE a;",
+		"migrations/002_b.up.sql":   "CREATE TABLE b (id int);",
+		"migrations/002_b.down.sql": "DROP TABLE b;",
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, executed, err := Run(ctx, "migrations", url, "up", WithSource(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/001_a.up.sql", "migrations/002_b.up.sql"}; n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	n, executed, err = Run(ctx, "migrations", url, "down", WithSource(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/002_b.down.sql", "migrations/001_a.down.sql"}; n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	_, _, err = Run(ctx, "other", url, "up", WithSource(src))
+	if !errors.Is(err, ErrNoMigrationFiles) {
+		t.Errorf("expected ErrNoMigrationFiles but got %v", err)
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/2024/003_c.up.sql":      {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/2024/003_c.down.sql":    {Data: []byte("DROP TABLE c;")},
+		"migrations/2023/002_b.sql":         {Data: []byte("-- +migration Up\nCREATE TABLE b (id int);\n-- +migration Down\nDROP TABLE b;\n")},
+		"migrations/2023/q1/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/2023/q1/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/004_d.up.sql":           {Data: []byte("CREATE TABLE d (id int);")},
+		"migrations/004_d.down.sql":         {Data: []byte("DROP TABLE d;")},
+		"migrations/README.md":              {Data: []byte("migrations by year")},
+	}
+	o := newOptions([]Option{Recursive(), WithFS(fsys)})
+	files, err := upFiles(SequentialStrategy{}, o.src, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"migrations/2023/q1/001_a.up.sql",
+		"migrations/2023/002_b.sql",
+		"migrations/2024/003_c.up.sql",
+		"migrations/004_d.up.sql",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("upFiles() = %v, want %v", files, want)
+	}
+	files, err = upFiles(SequentialStrategy{}, FSSource(fsys), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/004_d.up.sql"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("expected only the top level files without Recursive but got %v", files)
+	}
+	files, err = downFiles(SequentialStrategy{}, newOptions([]Option{Recursive()}).src, "./testdata/nested", []int64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"testdata/nested/003_c.down.sql", "testdata/nested/2024/002_b.down.sql", "testdata/nested/2023/001_a.down.sql"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("downFiles() = %v, want %v", files, want)
+	}
+	fsys["migrations/2024/001_dup.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	_, err = upFiles(SequentialStrategy{}, o.src, "migrations")
+	if !errors.Is(err, ErrDuplicateVersion) {
+		t.Errorf("expected ErrDuplicateVersion across folders but got %v", err)
+	}
+}
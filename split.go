@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"strings"
+)
+
+// splitStatements split the SQL on the semicolons that end statements,
+// semicolons inside quotes, dollar quoted bodies and comments are kept
+func splitStatements(sql string) (statements []string) {
+	var (
+		start int
+		i     int
+	)
+	add := func(end int) {
+		s := strings.TrimSpace(sql[start:end])
+		if s != "" {
+			statements = append(statements, s)
+		}
+	}
+	for i < len(sql) {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			i = skipQuoted(sql, i, c)
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			n := strings.IndexByte(sql[i:], '\n')
+			if n < 0 {
+				i = len(sql)
+				continue
+			}
+			i += n + 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			n := strings.Index(sql[i+2:], "*/")
+			if n < 0 {
+				i = len(sql)
+				continue
+			}
+			i += n + 4
+		case c == '$':
+			i = skipDollarQuoted(sql, i)
+		case c == ';':
+			add(i)
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	add(len(sql))
+	return
+}
+
+// skipQuoted return the position after the quoted text starting at i,
+// a doubled quote is an escaped quote
+func skipQuoted(sql string, i int, quote byte) int {
+	for i++; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return i
+}
+
+// skipDollarQuoted return the position after the $tag$ quoted body
+// starting at i or i+1 when it's not a dollar quote, e.g. $1
+func skipDollarQuoted(sql string, i int) int {
+	end := strings.IndexByte(sql[i+1:], '$')
+	if end < 0 {
+		return i + 1
+	}
+	tag := sql[i : i+end+2]
+	for _, r := range tag[1 : len(tag)-1] {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return i + 1
+		}
+	}
+	if len(tag) > 2 && tag[1] >= '0' && tag[1] <= '9' {
+		return i + 1
+	}
+	n := strings.Index(sql[i+len(tag):], tag)
+	if n < 0 {
+		return len(sql)
+	}
+	return i + len(tag) + n + len(tag)
+}
@@ -0,0 +1,128 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_splitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "two statements",
+			sql:  "CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n",
+			want: []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"},
+		},
+		{
+			name: "without last semicolon",
+			sql:  "CREATE TABLE a (id int); CREATE TABLE b (id int)",
+			want: []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"},
+		},
+		{
+			name: "semicolon in string",
+			sql:  "INSERT INTO a VALUES ('x;y', 'it''s;');",
+			want: []string{"INSERT INTO a VALUES ('x;y', 'it''s;')"},
+		},
+		{
+			name: "semicolon in identifier",
+			sql:  `CREATE TABLE "a;b" (id int);`,
+			want: []string{`CREATE TABLE "a;b" (id int)`},
+		},
+		{
+			name: "semicolon in comments",
+			sql:  "-- drop; create\nCREATE TABLE a (id int); /* x; y */ CREATE TABLE b (id int);",
+			want: []string{"-- drop; create\nCREATE TABLE a (id int)", "/* x; y */ CREATE TABLE b (id int)"},
+		},
+		{
+			name: "dollar quoted body",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;\nSELECT f();",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "SELECT f()"},
+		},
+		{
+			name: "tagged dollar quoted body",
+			sql:  "DO $body$ BEGIN PERFORM 1; END $body$; SELECT $1;",
+			want: []string{"DO $body$ BEGIN PERFORM 1; END $body$", "SELECT $1"},
+		},
+		{
+			name: "empty statements",
+			sql:  ";\n  ;",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSplitStatements(t *testing.T) {
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	source := t.TempDir()
+	files := map[string]string{
+		"001_a.up.sql":   "CREATE TABLE split_a (id int);\nCREATE TABLE split_b (id int);\n",
+		"001_a.down.sql": "DROP TABLE split_b;\nDROP TABLE split_a;\n",
+	}
+	for name, sql := range files {
+		err := os.WriteFile(filepath.Join(source, name), []byte(sql), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := Run(context.Background(), source, url, "up", SplitStatements())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Run(context.Background(), source, url, "down", SplitStatements()) // nolint
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	err = db.Get(&count, `SELECT count(*) FROM information_schema.tables WHERE table_name IN ('split_a', 'split_b')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected both tables created but got %v", count)
+	}
+}
+
+func TestRunVerbose(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);\nINSERT INTO a (id) VALUES (1);\n")},
+		"migrations/001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	var buf bytes.Buffer
+	_, _, err := Run(ctx, "migrations", url, "up", WithFS(fsys), SplitStatements(), Verbose(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-- migrations/001_a.up.sql\nCREATE TABLE a (id int)\n-- migrations/001_a.up.sql\nINSERT INTO a (id) VALUES (1)\n"
+	if buf.String() != want {
+		t.Errorf("expected %q but got %q", want, buf.String())
+	}
+	buf.Reset()
+	_, _, err = Run(ctx, "migrations", url, "down", WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no statements without Verbose but got %q", buf.String())
+	}
+}
@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SSLConfig holds the PostgreSQL SSL connection parameters,
+// the empty fields keep the values of the database URL
+type SSLConfig struct {
+	Mode     string
+	Cert     string
+	Key      string
+	RootCert string
+}
+
+// params return the non empty parameters in the libpq order
+func (s SSLConfig) params() [][2]string {
+	var p [][2]string
+	for _, kv := range [][2]string{
+		{"sslmode", s.Mode},
+		{"sslcert", s.Cert},
+		{"sslkey", s.Key},
+		{"sslrootcert", s.RootCert},
+	} {
+		if kv[1] != "" {
+			p = append(p, kv)
+		}
+	}
+	return p
+}
+
+// withSSL merges the SSL parameters into a PostgreSQL URL or key=value
+// connection string, other databases ignore them, the certificate
+// files must exist
+func withSSL(dbURL string, cfg *DatabaseConfig, ssl SSLConfig) (string, error) {
+	params := ssl.params()
+	if len(params) == 0 || !cfg.postgres() {
+		return dbURL, nil
+	}
+	for _, kv := range params {
+		if kv[0] == "sslmode" {
+			continue
+		}
+		_, err := os.Stat(kv[1])
+		if err != nil {
+			return "", fmt.Errorf("%v: %w", kv[0], err)
+		}
+	}
+	return withParams(dbURL, params)
+}
+
+// withSchema sets the PostgreSQL search_path of all the connections,
+// other databases ignore it
+func withSchema(dbURL string, cfg *DatabaseConfig, schema string) (string, error) {
+	if schema == "" || !cfg.postgres() {
+		return dbURL, nil
+	}
+	return withParams(dbURL, [][2]string{{"search_path", schema}})
+}
+
+// withParams merges params into a PostgreSQL URL or key=value
+// connection string
+func withParams(dbURL string, params [][2]string) (string, error) {
+	if !strings.Contains(dbURL, "://") {
+		for _, kv := range params {
+			dbURL += " " + kv[0] + "=" + quoteParam(kv[1])
+		}
+		return strings.TrimSpace(dbURL), nil
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "", maskErr(err)
+	}
+	q := u.Query()
+	for _, kv := range params {
+		q.Set(kv[0], kv[1])
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// quoteParam quotes a key=value connection string value
+func quoteParam(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+	return "'" + v + "'"
+}
@@ -0,0 +1,138 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_withSSL(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca's.crt")
+	err := os.WriteFile(ca, []byte("cert"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		url  string
+		cfg  DatabaseConfig
+		ssl  SSLConfig
+		want string
+	}{
+		{
+			name: "url",
+			url:  "postgres://postgres@localhost:5432/test?sslmode=disable",
+			cfg:  postgresConfig,
+			ssl:  SSLConfig{Mode: "verify-full", RootCert: ca},
+			want: "postgres://postgres@localhost:5432/test?sslmode=verify-full&sslrootcert=" + url.QueryEscape(ca),
+		},
+		{
+			name: "connection string",
+			url:  "host=localhost dbname=test",
+			cfg:  postgresConfig,
+			ssl:  SSLConfig{Mode: "require", RootCert: ca},
+			want: `host=localhost dbname=test sslmode='require' sslrootcert='` + strings.ReplaceAll(ca, `'`, `\'`) + `'`,
+		},
+		{
+			name: "without ssl",
+			url:  "postgres://postgres@localhost:5432/test?sslmode=disable",
+			cfg:  postgresConfig,
+			want: "postgres://postgres@localhost:5432/test?sslmode=disable",
+		},
+		{
+			name: "sqlite ignores ssl",
+			url:  "sqlite:///tmp/test.db",
+			cfg:  sqliteConfig,
+			ssl:  SSLConfig{Mode: "require", Cert: "missing.crt"},
+			want: "sqlite:///tmp/test.db",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withSSL(tt.url, &tt.cfg, tt.ssl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("withSSL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	_, err = withSSL("postgres://localhost/test", &postgresConfig, SSLConfig{Key: filepath.Join(t.TempDir(), "missing.key")})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing key file error but got %v", err)
+	}
+}
+
+func Test_withSchema(t *testing.T) {
+	pgx := postgresConfig
+	pgx.DriverName = pgxDriverName
+	tests := []struct {
+		name string
+		url  string
+		cfg  DatabaseConfig
+		want string
+	}{
+		{name: "url", url: "postgres://postgres@localhost:5432/test", cfg: postgresConfig, want: "postgres://postgres@localhost:5432/test?search_path=tenant_a"},
+		{name: "connection string", url: "host=localhost dbname=test", cfg: postgresConfig, want: "host=localhost dbname=test search_path='tenant_a'"},
+		{name: "pgx", url: "postgres://postgres@localhost:5432/test", cfg: pgx, want: "postgres://postgres@localhost:5432/test?search_path=tenant_a"},
+		{name: "sqlite ignores schema", url: "sqlite:///tmp/test.db", cfg: sqliteConfig, want: "sqlite:///tmp/test.db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withSchema(tt.url, &tt.cfg, "tenant_a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("withSchema() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSchema(t *testing.T) {
+	ctx := context.Background()
+	url := "postgres://postgres@localhost:5432/test?sslmode=disable"
+	db, err := sqlx.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE SCHEMA IF NOT EXISTS tenant_a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DROP SCHEMA tenant_a CASCADE`) // nolint
+	source := t.TempDir()
+	files := map[string]string{
+		"001_a.up.sql":   `CREATE TABLE tenant_users (id int);`,
+		"001_a.down.sql": `DROP TABLE tenant_users;`,
+	}
+	for name, sql := range files {
+		err = os.WriteFile(filepath.Join(source, name), []byte(sql), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err = Run(ctx, source, url, "up", Schema("tenant_a"), TableName("tenant_migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	err = db.Select(&tables, `SELECT table_name FROM information_schema.tables WHERE table_schema = 'tenant_a' ORDER BY table_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tenant_migrations", "tenant_users"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("expected %v in the tenant_a schema but got %v", want, tables)
+	}
+}
@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// stdinFile names the SQL of ExecSQL in the logs and errors
+const stdinFile = "stdin"
+
+// ExecSQL executes the SQL read from r in a transaction, e.g. a one-off
+// script piped to the command, when version is not 0 it is recorded in
+// the migrations table with the checksum of the SQL
+func ExecSQL(ctx context.Context, url string, r io.Reader, version int64, opts ...Option) (err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(string(b)) == "" {
+		return fmt.Errorf("%w from %v", ErrNoMigrationFiles, stdinFile)
+	}
+	cfg, err := GetDatabaseConfig(url)
+	if err != nil {
+		return
+	}
+	m, err := configure(cfg, opts)
+	if err != nil {
+		return
+	}
+	err = m.open(ctx, url)
+	if err != nil {
+		return
+	}
+	defer m.db.Close() // nolint
+	_, _, err = m.lockedWithoutSource(ctx, func() (int, []string, error) {
+		return 0, nil, m.execSQL(ctx, b, version)
+	})
+	return
+}
+
+// execSQL executes b and records version in the same transaction
+func (m *Migrator) execSQL(ctx context.Context, b []byte, version int64) (err error) {
+	if m.opts.dryRun != nil {
+		_, err = fmt.Fprintf(m.opts.dryRun, "-- %v\n%v\n\n", stdinFile, strings.TrimSpace(string(b)))
+		return
+	}
+	run, err := m.sqlFunc(stdinFile, b)
+	if err != nil {
+		return
+	}
+	start := time.Now()
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	if version != 0 {
+		err = insertMigrations(ctx, version, stdinFile, checksum(b), tx, m.cfg)
+		if errors.Is(err, errAlreadyApplied) {
+			err = fmt.Errorf("version %v is already recorded", version)
+		}
+		if err != nil {
+			m.rollback(tx)
+			return
+		}
+	}
+	err = run(ctx, tx)
+	if err != nil {
+		m.rollback(tx)
+		return &MigrationError{file: stdinFile, err: err}
+	}
+	err = m.commit(tx)
+	if err != nil {
+		return
+	}
+	m.opts.log.Info("migration applied", "version", version, "file", stdinFile, "duration", time.Since(start))
+	return
+}
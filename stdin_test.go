@@ -0,0 +1,53 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestExecSQL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	err := ExecSQL(ctx, url, strings.NewReader("CREATE TABLE a (id int);"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ExecSQL(ctx, url, strings.NewReader("INSERT INTO a (id) VALUES (1);"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ExecSQL(ctx, url, strings.NewReader("INSERT INTO a (id) VALUES (2);"), 7)
+	if err == nil || !strings.Contains(err.Error(), "already recorded") {
+		t.Errorf("expected the recorded version error but got %v", err)
+	}
+	err = ExecSQL(ctx, url, strings.NewReader("  \n"), 0)
+	if err == nil {
+		t.Error("expected an error for empty SQL")
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var ids []int
+	err = db.Select(&ids, `SELECT id FROM a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("expected only the first insert but got %v", ids)
+	}
+	versions, err := AppliedVersions(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []int64{7}) {
+		t.Errorf("expected version 7 recorded but got %v", versions)
+	}
+}
@@ -0,0 +1,178 @@
+package migration
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionStrategy parses the version of the migration file names
+// and orders the versions, see WithVersionStrategy
+type VersionStrategy interface {
+	// Parse return the version of the file name
+	Parse(filename string) (int64, error)
+	// Compare return -1, 0 or +1 when a is lower, equal or greater than b
+	Compare(a, b int64) int
+}
+
+// TimeStrategy is a VersionStrategy whose versions are times,
+// up-to-date requires it
+type TimeStrategy interface {
+	VersionStrategy
+	// VersionAt return the version of the time t
+	VersionAt(t time.Time) int64
+}
+
+// SequentialStrategy is the default NNN_name convention, e.g.
+// 001_create_users.up.sql
+type SequentialStrategy struct{}
+
+// Parse return the number before the first underscore
+func (SequentialStrategy) Parse(filename string) (int64, error) {
+	prefix := strings.SplitN(path.Base(filename), "_", 2)[0]
+	return strconv.ParseInt(prefix, 10, 64)
+}
+
+// Compare orders the versions numerically
+func (SequentialStrategy) Compare(a, b int64) int {
+	return cmp.Compare(a, b)
+}
+
+// timestampLayout is the UTC time prefix of TimestampStrategy
+const timestampLayout = "20060102150405"
+
+// TimestampStrategy is the YYYYMMDDHHMMSS_name convention, e.g.
+// 20240131120000_create_users.up.sql, the prefix must be a valid time
+type TimestampStrategy struct{}
+
+// Parse return the timestamp before the first underscore as a number
+func (TimestampStrategy) Parse(filename string) (int64, error) {
+	prefix := strings.SplitN(path.Base(filename), "_", 2)[0]
+	if len(prefix) != len(timestampLayout) {
+		return 0, fmt.Errorf("%q is not a %v timestamp", prefix, timestampLayout)
+	}
+	_, err := time.Parse(timestampLayout, prefix)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(prefix, 10, 64)
+}
+
+// Compare orders the timestamps chronologically
+func (TimestampStrategy) Compare(a, b int64) int {
+	return cmp.Compare(a, b)
+}
+
+// VersionAt return t in UTC as a YYYYMMDDHHMMSS number
+func (TimestampStrategy) VersionAt(t time.Time) int64 {
+	v, _ := strconv.ParseInt(t.UTC().Format(timestampLayout), 10, 64) // nolint
+	return v
+}
+
+// patternStrategy extracts the version with the version group of re
+type patternStrategy struct {
+	SequentialStrategy
+	re *regexp.Regexp
+}
+
+func (s patternStrategy) Parse(filename string) (int64, error) {
+	m := s.re.FindStringSubmatch(path.Base(filename))
+	if m == nil {
+		return 0, fmt.Errorf("doesn't match %v", s.re)
+	}
+	return strconv.ParseInt(m[s.re.SubexpIndex("version")], 10, 64)
+}
+
+// NewPatternStrategy return the strategy extracting the version from
+// the migration file names with expr, it must have a version named
+// group, e.g. `^V(?P<version>\d+)__` for Flyway names
+func NewPatternStrategy(expr string) (VersionStrategy, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if re.SubexpIndex("version") < 0 {
+		return nil, fmt.Errorf("filename pattern %q has no version group", expr)
+	}
+	return patternStrategy{re: re}, nil
+}
+
+// version parse the migration number from the file name with vs,
+// Go migrations always use SequentialStrategy
+func version(vs VersionStrategy, file string) (n int64, err error) {
+	if strings.Contains(path.Base(file), goMigrationSuffix) {
+		vs = SequentialStrategy{}
+	}
+	v, err := vs.Parse(file)
+	if err != nil {
+		err = &VersionError{file: file, err: err}
+		return
+	}
+	return v, nil
+}
+
+// migrationName return the file name without the version and the
+// extension, e.g. create_users of 001_create_users.up.sql
+func migrationName(file string) string {
+	name := strings.TrimSuffix(path.Base(file), templateSuffix)
+	for _, ext := range []string{".up.sql", ".down.sql", ".sql", ".up", ".down"} {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	if prefix, rest, ok := strings.Cut(name, "_"); ok && strings.ContainsAny(prefix, "0123456789") {
+		name = rest
+	}
+	return strings.TrimLeft(name, "_")
+}
+
+// dateLayouts are accepted by the up-to-date action
+var dateLayouts = []string{"2006-01-02", time.RFC3339, timestampLayout}
+
+// parseDate parse the date of the up-to-date action, dates without
+// time are the end of that day in UTC
+func parseDate(s string) (t time.Time, err error) {
+	for _, layout := range dateLayouts {
+		t, err = time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t.UTC(), nil
+	}
+	return t, fmt.Errorf("%w, invalid date %q, use YYYY-MM-DD or RFC 3339", ErrInvalidSyntax, s)
+}
+
+// versionAt return the highest version of files at or before t, 0 when
+// all the files are after t, it requires a TimeStrategy
+func versionAt(vs VersionStrategy, files []string, t time.Time) (target int64, err error) {
+	ts, ok := vs.(TimeStrategy)
+	if !ok {
+		return 0, errors.New("up-to-date requires a timestamp version strategy")
+	}
+	limit := ts.VersionAt(t)
+	for _, f := range files {
+		var v int64
+		v, err = version(vs, f)
+		if err != nil {
+			return
+		}
+		if v <= limit && v > target {
+			target = v
+		}
+	}
+	return
+}
+
+// compareVersions orders a and b with vs
+func compareVersions(vs VersionStrategy, a, b int64) int {
+	return vs.Compare(a, b)
+}
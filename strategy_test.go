@@ -0,0 +1,213 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSequentialStrategy(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    int64
+		wantErr bool
+	}{
+		{file: "migrations/001_create_users.up.sql", want: 1},
+		{file: "42_users.sql", want: 42},
+		{file: "004_go_migration.up", want: 4},
+		{file: "create_users.up.sql", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := SequentialStrategy{}.Parse(tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if (SequentialStrategy{}).Compare(2, 10) >= 0 {
+		t.Error("expected 2 before 10")
+	}
+}
+
+func Test_migrationName(t *testing.T) {
+	tests := map[string]string{
+		"migrations/001_create_users.up.sql":  "create_users",
+		"002_add_email.down.sql":              "add_email",
+		"42_users.sql":                        "users",
+		"20240131120000_create_orders.up.sql": "create_orders",
+		"003_seed.up.sql.tmpl":                "seed",
+		"004_go_migration.up":                 "go_migration",
+		"stdin":                               "stdin",
+	}
+	for file, want := range tests {
+		if got := migrationName(file); got != want {
+			t.Errorf("migrationName(%v) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestTimestampStrategy(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    int64
+		wantErr bool
+	}{
+		{file: "migrations/20240131120000_create_users.up.sql", want: 20240131120000},
+		{file: "20231231235959_users.sql", want: 20231231235959},
+		{file: "001_create_users.up.sql", wantErr: true},
+		{file: "20241331120000_invalid_month.up.sql", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := TimestampStrategy{}.Parse(tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if (TimestampStrategy{}).Compare(20240131120000, 20231231235959) <= 0 {
+		t.Error("expected 2024 after 2023")
+	}
+}
+
+func TestWithVersionStrategy(t *testing.T) {
+	vs := TimestampStrategy{}
+	fsys := fstest.MapFS{
+		"migrations/20240131120000_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/20240131120000_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/20231231235959_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/20231231235959_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	files, err := upFiles(vs, FSSource(fsys), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/20231231235959_a.up.sql", "migrations/20240131120000_b.up.sql"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("expected %v but got %v", want, files)
+	}
+	fsys["migrations/003_c.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id int);")}
+	_, err = upFiles(vs, FSSource(fsys), "migrations")
+	if err == nil {
+		t.Error("expected an error for a sequential name with the timestamp strategy")
+	}
+	delete(fsys, "migrations/003_c.up.sql")
+
+	seq := fstest.MapFS{
+		"migrations/001_a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _, errs[0] = Run(ctx, "migrations", "sqlite://"+filepath.Join(dir, "ts.db"), "up", WithFS(fsys), WithVersionStrategy(vs))
+	}()
+	go func() {
+		defer wg.Done()
+		_, _, errs[1] = Run(ctx, "migrations", "sqlite://"+filepath.Join(dir, "seq.db"), "up", WithFS(seq))
+	}()
+	wg.Wait()
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("expected each migrator to use its own strategy but got %v", errs)
+	}
+}
+
+func TestRunUpToDate(t *testing.T) {
+	ts := WithVersionStrategy(TimestampStrategy{})
+	fsys := fstest.MapFS{
+		"migrations/20240115090000_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/20240115090000_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"migrations/20240201235959_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/20240201235959_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/20240202000000_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"migrations/20240202000000_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	ctx := context.Background()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	n, _, err := Run(ctx, "migrations", url, "up-to-date 2023-12-31", WithFS(fsys), ts)
+	if err != nil || n != 0 {
+		t.Fatalf("expected nothing before the first migration but got %v %v", n, err)
+	}
+	n, executed, err := Run(ctx, "migrations", url, "up-to-date 2024-02-01", WithFS(fsys), ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"migrations/20240115090000_a.up.sql", "migrations/20240201235959_b.up.sql"}
+	if n != 2 || !reflect.DeepEqual(executed, want) {
+		t.Errorf("expected %v executed but got %v %v", want, n, executed)
+	}
+	n, _, err = Run(ctx, "migrations", url, "up-to-date 2024-01-20", WithFS(fsys), ts)
+	if err != nil || n != 0 {
+		t.Errorf("expected an earlier date to change nothing but got %v %v", n, err)
+	}
+	n, _, err = Run(ctx, "migrations", url, "up-to-date 2099-01-01T00:00:00Z", WithFS(fsys), ts)
+	if err != nil || n != 1 {
+		t.Errorf("expected a future date to execute the last migration but got %v %v", n, err)
+	}
+	_, _, err = Run(ctx, "migrations", url, "up-to-date yesterday", WithFS(fsys), ts)
+	if !errors.Is(err, ErrInvalidSyntax) {
+		t.Errorf("expected an invalid date error but got %v", err)
+	}
+	_, _, err = Run(ctx, "testdata/noversion", url, "up-to-date 2024-02-01")
+	if err == nil {
+		t.Error("expected an error without the timestamp strategy")
+	}
+}
+
+func TestNewPatternStrategy(t *testing.T) {
+	vs, err := NewPatternStrategy(`^V(?P<version>\d+)__`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		file    string
+		want    int64
+		wantErr bool
+	}{
+		{name: "flyway up file", file: "migrations/V001__create_users.up.sql", want: 1},
+		{name: "flyway single file", file: "migrations/V12__add_index.sql", want: 12},
+		{name: "default convention", file: "migrations/001_name.up.sql", wantErr: true},
+		{name: "go migration", file: "004_go_migration.up", want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := version(vs, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("version() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("version() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	fsys := fstest.MapFS{
+		"migrations/V2__b.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/V1__a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+	}
+	files, err := upFiles(vs, FSSource(fsys), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"migrations/V1__a.up.sql", "migrations/V2__b.up.sql"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("upFiles() = %v, want %v", files, want)
+	}
+	if _, err = NewPatternStrategy(`^V(\d+)__`); err == nil {
+		t.Error("expected an error for a pattern without the version group")
+	}
+}
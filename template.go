@@ -0,0 +1,83 @@
+package migration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateSuffix marks the migration files rendered with text/template,
+// e.g. 001_partitions.up.sql.tmpl
+const templateSuffix = ".tmpl"
+
+// templateDataExts are the sibling data files of the templates,
+// YAML also reads JSON
+var templateDataExts = []string{".json", ".yaml", ".yml"}
+
+// isTemplate report if the migration file is a template
+func isTemplate(file string) bool {
+	return strings.HasSuffix(file, templateSuffix)
+}
+
+// templateDataFile return the data file name of a template without
+// extension, 001_partitions for 001_partitions.up.sql.tmpl
+func templateDataFile(file string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(file, templateSuffix), ".sql")
+	for _, direction := range []string{".up", ".down"} {
+		name = strings.TrimSuffix(name, direction)
+	}
+	return name
+}
+
+// templateData return the data of the template file, the first sibling
+// data file found merged with the TemplateVars option
+func (m *Migrator) templateData(file string) (data map[string]any, err error) {
+	data = map[string]any{}
+	for _, ext := range templateDataExts {
+		name := templateDataFile(file) + ext
+		var b []byte
+		b, err = readFile(m.opts.src, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		err = yaml.Unmarshal(b, &data)
+		if err != nil {
+			err = fmt.Errorf("%v: %w", name, err)
+			return
+		}
+		break
+	}
+	err = nil
+	for k, v := range m.opts.templateVars {
+		data[k] = v
+	}
+	return
+}
+
+// render executes the migration template with its data, a
+// missing key is an error
+func (m *Migrator) render(file string, b []byte) ([]byte, error) {
+	data, err := m.templateData(file)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(path.Base(file)).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRunTemplate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	url := "sqlite://" + path
+	n, executed, err := Run(ctx, "testdata/template", url, "up", TemplateVars(map[string]string{"table": "logs"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !reflect.DeepEqual(executed, []string{"testdata/template/001_partitions.up.sql.tmpl"}) {
+		t.Errorf("expected the template executed but got %v %v", n, executed)
+	}
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tables []string
+	err = db.Select(&tables, `SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'logs_%' ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"logs_2024_01", "logs_2024_02", "logs_2024_03"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("expected the tables %v but got %v", want, tables)
+	}
+	_, _, err = Run(ctx, "testdata/template", url, "down", TemplateVars(map[string]string{"table": "logs"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables = nil
+	err = db.Select(&tables, `SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'logs_%'`)
+	if err != nil || len(tables) != 0 {
+		t.Errorf("expected the tables dropped by the down template but got %v %v", tables, err)
+	}
+}
+
+func TestRunTemplateDryRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_a.up.sql.tmpl":   {Data: []byte("CREATE TABLE {{ .name }} (id int);")},
+		"migrations/001_a.down.sql.tmpl": {Data: []byte("DROP TABLE {{ .name }};")},
+		"migrations/001_a.json":          {Data: []byte(`{"name": "users"}`)},
+		"migrations/002_b.up.sql.tmpl":   {Data: []byte("CREATE TABLE {{ .missing }} (id int);")},
+		"migrations/002_b.down.sql":      {Data: []byte("DROP TABLE b;")},
+	}
+	var out bytes.Buffer
+	url := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	_, _, err := Run(context.Background(), "migrations", url, "up 1", WithFS(fsys), DryRun(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "CREATE TABLE users (id int);") {
+		t.Errorf("expected the rendered SQL but got %q", out.String())
+	}
+	_, _, err = Run(context.Background(), "migrations", url, "up", WithFS(fsys))
+	if err == nil || !strings.Contains(err.Error(), "002_b.up.sql.tmpl") {
+		t.Errorf("expected the missing key error of 002_b but got %v", err)
+	}
+}
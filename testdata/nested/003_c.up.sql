@@ -0,0 +1 @@
+CREATE TABLE nested_c (id int);
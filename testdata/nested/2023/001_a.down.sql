@@ -0,0 +1 @@
+DROP TABLE nested_a;
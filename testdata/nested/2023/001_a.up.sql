@@ -0,0 +1 @@
+CREATE TABLE nested_a (id int);
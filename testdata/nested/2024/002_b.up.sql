@@ -0,0 +1 @@
+CREATE TABLE nested_b (id int);